@@ -0,0 +1,178 @@
+// SPDX-FileCopyrightText: 2020 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package v1alpha1
+
+import (
+	cmmeta "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// CredentialsTokenKey is the key of the Github API token in the credentials secret.
+	CredentialsTokenKey = "token"
+	// CredentialsSSHPrivateKeyKey is the key of the SSH private key in the credentials secret.
+	CredentialsSSHPrivateKeyKey = corev1.SSHAuthPrivateKey
+
+	// ConditionReady indicates whether the repository was cloned and is synchronized.
+	ConditionReady = "Ready"
+)
+
+// GitCertSourceSpec defines a Git repository containing certificate configuration.
+type GitCertSourceSpec struct {
+	// RemoteURL is the remote URL of the repository.
+	RemoteURL string `json:"remoteURL"`
+
+	// Branch is the name of the branch to synchronize with. Defaults to the controller's branch.
+	// +optional
+	Branch string `json:"branch,omitempty"`
+
+	// CredentialsSecretRef references a Secret in the same namespace containing
+	// either a Github API token (key: token) or an SSH private key (key: ssh-privatekey).
+	// The credentials of the controller are never used for GitCertSources.
+	CredentialsSecretRef *corev1.LocalObjectReference `json:"credentialsSecretRef"`
+
+	// SyncPeriod is the period in which synchronization with the repository is guaranteed.
+	// Defaults to the controller's sync period.
+	// +optional
+	SyncPeriod *metav1.Duration `json:"syncPeriod,omitempty"`
+
+	// ConfigFileName is the name of the files containing the certificate configuration.
+	// Defaults to the controller's config file name.
+	// +optional
+	ConfigFileName string `json:"configFileName,omitempty"`
+
+	// DefaultIssuer is the issuer used to sign certificate requests. Defaults to the controller's default issuer.
+	// +optional
+	DefaultIssuer *cmmeta.IssuerReference `json:"defaultIssuer,omitempty"`
+
+	// RenewBefore triggers renewal of certificates expiring in less than the given duration.
+	// Defaults to the controller's setting.
+	// +optional
+	RenewBefore *metav1.Duration `json:"renewBefore,omitempty"`
+
+	// Git configures how certificates are written to Git.
+	// +optional
+	Git GitSpec `json:"git,omitempty"`
+
+	// Vault configures how certificates are written to Vault.
+	// +optional
+	Vault VaultSpec `json:"vault,omitempty"`
+}
+
+// GitSpec configures how certificates are written to Git.
+type GitSpec struct {
+	// PushCertificates defines whether to write certificates into Git. Defaults to the controller's setting.
+	// +optional
+	PushCertificates *bool `json:"pushCertificates,omitempty"`
+
+	// DryRun writes certificates into the local clone without pushing them.
+	// +optional
+	DryRun bool `json:"dryRun,omitempty"`
+
+	// Output optionally configures a separate repository or branch certificates are written to.
+	// +optional
+	Output *GitOutputSpec `json:"output,omitempty"`
+}
+
+// GitOutputSpec configures a separate repository or branch certificates are written to.
+type GitOutputSpec struct {
+	// RemoteURL is the remote URL of the repository. Defaults to the repository containing the configuration.
+	// +optional
+	RemoteURL string `json:"remoteURL,omitempty"`
+
+	// Branch is the name of the branch. Defaults to the branch containing the configuration.
+	// +optional
+	Branch string `json:"branch,omitempty"`
+
+	// Path is the folder certificates are written to.
+	// +optional
+	Path string `json:"path,omitempty"`
+
+	// CredentialsSecretRef references a Secret in the same namespace containing the credentials for the output repository.
+	// Defaults to the credentials of the repository containing the configuration.
+	// +optional
+	CredentialsSecretRef *corev1.LocalObjectReference `json:"credentialsSecretRef,omitempty"`
+}
+
+// VaultSpec configures how certificates are written to Vault.
+// Vault is accessed with the identity of the controller, so only the KV engines allowed by the controller's
+// --git-cert-source-vault-kv-engines can be used.
+type VaultSpec struct {
+	// PushCertificates defines whether to write certificates into Vault. Defaults to the controller's setting.
+	// +optional
+	PushCertificates *bool `json:"pushCertificates,omitempty"`
+
+	// UpdateMetadata defines whether to update the metadata of certificates in Vault. Defaults to the controller's setting.
+	// +optional
+	UpdateMetadata *bool `json:"updateMetadata,omitempty"`
+
+	// KVEngine is the name of the KV engine certificates are stored in. Defaults to the controller's setting.
+	// +optional
+	KVEngine string `json:"kvEngine,omitempty"`
+}
+
+// GitCertSourceStatus reports the state of the repository.
+type GitCertSourceStatus struct {
+	// ObservedGeneration is the generation of the spec the status refers to.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// LastSyncedCommit is the commit the local clone was last synchronized to.
+	// +optional
+	LastSyncedCommit string `json:"lastSyncedCommit,omitempty"`
+
+	// LastSyncTime is the time of the last successful synchronization.
+	// +optional
+	LastSyncTime *metav1.Time `json:"lastSyncTime,omitempty"`
+
+	// Certificates is the number of configured certificates.
+	// +optional
+	Certificates int `json:"certificates"`
+
+	// SyncedCertificates is the number of certificates that were synchronized successfully.
+	// +optional
+	SyncedCertificates int `json:"syncedCertificates"`
+
+	// FailedCertificates is the number of certificates that failed to synchronize.
+	// +optional
+	FailedCertificates int `json:"failedCertificates"`
+
+	// Errors lists the most recent errors.
+	// +optional
+	Errors []string `json:"errors,omitempty"`
+
+	// Conditions of the GitCertSource.
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Remote URL",type=string,JSONPath=`.spec.remoteURL`
+// +kubebuilder:printcolumn:name="Commit",type=string,JSONPath=`.status.lastSyncedCommit`
+// +kubebuilder:printcolumn:name="Certificates",type=integer,JSONPath=`.status.certificates`
+// +kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+
+// GitCertSource is a Git repository containing certificate configuration handled by the git-cert-shim.
+type GitCertSource struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   GitCertSourceSpec   `json:"spec,omitempty"`
+	Status GitCertSourceStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// GitCertSourceList contains a list of GitCertSource.
+type GitCertSourceList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []GitCertSource `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&GitCertSource{}, &GitCertSourceList{})
+}
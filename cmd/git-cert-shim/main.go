@@ -5,11 +5,13 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"net/http"
 	_ "net/http/pprof" //nolint:gosec
 	"os"
+	"strings"
 	"time"
 
 	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
@@ -24,9 +26,13 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 	"sigs.k8s.io/controller-runtime/pkg/metrics/server"
 
+	"github.com/sapcc/git-cert-shim/api/v1alpha1"
 	"github.com/sapcc/git-cert-shim/controllers"
+	"github.com/sapcc/git-cert-shim/pkg/certificate"
 	"github.com/sapcc/git-cert-shim/pkg/config"
 	"github.com/sapcc/git-cert-shim/pkg/git"
+	"github.com/sapcc/git-cert-shim/pkg/policy"
+	"github.com/sapcc/git-cert-shim/pkg/util"
 	"github.com/sapcc/git-cert-shim/pkg/vault"
 	"github.com/sapcc/git-cert-shim/pkg/version"
 	// +kubebuilder:scaffold:imports
@@ -42,19 +48,30 @@ var (
 func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
 	utilruntime.Must(certmanagerv1.AddToScheme(scheme))
+	utilruntime.Must(v1alpha1.AddToScheme(scheme))
 	// +kubebuilder:scaffold:scheme
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "check" {
+		os.Exit(runCheck(os.Args[2:]))
+	}
+
 	var (
 		profilerAddr,
-		metricsAddr string
+		metricsAddr,
+		repositoriesConfigFile string
 		isPrintVersionAndExit,
-		enableLeaderElection bool
-		gitOpts        git.Options
-		vaultOpts      vault.Options
-		controllerOpts config.ControllerOptions
-		debug          bool
+		enableLeaderElection,
+		watchGitCertSources bool
+		gitCertSourceVaultKVEngines []string
+		gitOpts                     git.Options
+		outputGitOpts               = git.Options{EnvVarPrefix: "GIT_OUTPUT"}
+		vaultOpts                   vault.Options
+		vaultMetadataFile           string
+		vaultTargetsFile            string
+		controllerOpts              config.ControllerOptions
+		debug                       bool
 	)
 
 	flag.StringVar(&profilerAddr, "profiler-addr", "localhost:6060", "The address to expose pprof profiler on.")
@@ -74,16 +91,77 @@ func main() {
 	flag.BoolVar(&gitOpts.IsEnsureEmptyDirectory, "ensure-empty-git-directory", true, "Ensure the creation of an empty directory for the git clone.")
 	flag.BoolVar(&gitOpts.PushCertificates, "git-push-certs", true, "Whether to write certificates into the Git repository. Set to false if you want to push to Vault only.")
 	flag.BoolVar(&gitOpts.DryRun, "dry-run", false, "Write certificates into local Git clone, but do not push them.")
+	flag.DurationVar(&gitOpts.CommitBatchWindow, "git-commit-batch-window", 0, "Collect written certificates for this duration and commit them together. Every certificate is committed separately if neither this nor --git-commit-batch-size is given.")
+	flag.IntVar(&gitOpts.CommitBatchSize, "git-commit-batch-size", 0, "Commit collected certificates once this number of certificates was written, even if the batch window did not elapse yet.")
+	flag.StringVar(&gitOpts.SigningKeyFile, "git-signing-key-file", "", "The file containing the GPG or SSH private key used to sign commits. The key must not be protected by a passphrase. Commits are not signed if empty.")
+	flag.StringVar(&gitOpts.SigningFormat, "git-signing-format", "", "The format of the signing key. Either openpgp or ssh. Detected from the key if empty.")
+	flag.StringVar(&gitOpts.TrustedSSHSignersFile, "git-trusted-ssh-signers-file", "", "The allowed signers file with the SSH keys trusted to change the certificate configuration. Enables verification of commit signatures.")
+	flag.StringVar(&gitOpts.TrustedGPGKeysFile, "git-trusted-gpg-keys-file", "", "The file with the GPG public keys trusted to change the certificate configuration. Enables verification of commit signatures.")
 
-	flag.BoolVar(&vaultOpts.PushCertificates, "vault-push-certs", false, "Whether to write certificates into a Vault KV engine. If set to true, Vault credentials must be given in environment variables (VAULT_ADDR and VAULT_ROLE_ID+VAULT_SECRET_ID for approle auth.)")
+	flag.BoolVar(&watchGitCertSources, "watch-git-cert-sources", false, "Handle the repositories configured by GitCertSource resources. --git-remote-url becomes optional.")
+	flag.Func("git-cert-source-vault-kv-engines", "Comma separated Vault KV engines GitCertSources may write to and read from with the Vault identity of the controller. GitCertSources have no access to Vault if not given.", func(v string) error {
+		gitCertSourceVaultKVEngines = strings.Split(v, ",")
+		return nil
+	})
+	flag.StringVar(&repositoriesConfigFile, "repositories-config-file", "", "A file listing the repositories to handle. Overrides --git-remote-url and the git output flags. Unset settings are taken from the respective flags.")
+
+	flag.StringVar(&outputGitOpts.RemoteURL, "git-output-remote-url", "", "The remote URL of a separate repository certificates are written to. Alternatively, provide via environment variable GIT_OUTPUT_REMOTE_URL. Defaults to the repository containing the configuration.")
+	flag.StringVar(&outputGitOpts.BranchName, "git-output-branch-name", "", "The name of the git branch certificates are written to. Defaults to the branch containing the configuration.")
+	flag.StringVar(&outputGitOpts.GithubToken, "github-output-api-token", "", "Github API token for the output repository. Alternatively, provide via environment variable GIT_OUTPUT_API_TOKEN. Defaults to the credentials of the configuration repository.")
+	flag.StringVar(&outputGitOpts.GithubSSHPrivkeyFilename, "github-output-ssh-privkey-file", "", "Github SSH private key filename for the output repository. Alternatively, provide via environment variable GIT_OUTPUT_SSH_PRIVKEY_FILE. Defaults to the credentials of the configuration repository.")
+	flag.StringVar(&outputGitOpts.PathPrefix, "git-output-path", "", "The folder in the output repository certificates are written to, relative to its root. The folder structure of the configuration repository is kept below it. Requires another branch or repository.")
+
+	flag.BoolVar(&vaultOpts.PushCertificates, "vault-push-certs", false, "Whether to write certificates into a Vault KV engine. If set to true, VAULT_ADDR must be given in the environment and the credentials of the auth method, see --vault-auth-method (VAULT_ROLE_ID+VAULT_SECRET_ID for approle auth.)")
 	flag.BoolVar(&vaultOpts.UpdateMetaData, "vault-update-metadata", false, "Whether to update the metadata of the certificate in Vault.")
 	flag.StringVar(&vaultOpts.KVEngineName, "vault-kv-engine", "secrets", "Name of KV engine where certificates will be stored in Vault.")
+	flag.StringVar(&vaultOpts.Namespace, "vault-namespace", "", "The Vault Enterprise namespace to log in and write certificates to. Defaults to VAULT_NAMESPACE. Can be overridden per configuration file.")
+	flag.Func("vault-payload", "Comma separated fields written to Vault for certificates. Any of "+strings.Join(vault.PayloadFields, ", ")+". (default "+strings.Join(vault.DefaultPayloadFields, ",")+")", func(v string) error {
+		vaultOpts.Payload = strings.Split(v, ",")
+		return nil
+	})
+	flag.Func("vault-payload-keys", "Comma separated keys the fields are written to in Vault, e.g. certificate=tls.crt,private-key=tls.key. Fields not given use their name as key.", func(v string) error {
+		vaultOpts.KeyNames = make(map[string]string)
+		for pair := range strings.SplitSeq(v, ",") {
+			field, name, ok := strings.Cut(pair, "=")
+			if !ok {
+				return fmt.Errorf("invalid key %q, must be <field>=<key>", pair)
+			}
+			vaultOpts.KeyNames[field] = name
+		}
+		return nil
+	})
+	flag.StringVar(&vaultMetadataFile, "vault-metadata-file", "", "A YAML file mapping keys of the custom metadata of certificates in Vault to Go templates. Defaults to the metadata written so far.")
+	flag.StringVar(&vaultTargetsFile, "vault-targets-file", "", "A YAML file with additional Vaults certificates are written to. Requires --vault-push-certs.")
+	flag.StringVar(&vaultOpts.RetirePolicy, "vault-retire-policy", vault.RetireKeep, "What to do with the secrets of certificates removed from the configuration. One of "+strings.Join(vault.RetirePolicies, ", ")+".")
+	flag.IntVar(&vaultOpts.MaxVersions, "vault-max-versions", 0, "The maximum number of versions kept of the secrets written. Zero keeps the setting of the secret or KV engine.")
+	flag.DurationVar(&vaultOpts.DriftCheckInterval, "vault-drift-check-interval", time.Hour, "How often to check that the secrets written to Vault still hold the certificates and rewrite them otherwise. 0 disables the check.")
+	flag.DurationVar(&vaultOpts.CacheTTL, "vault-cache-ttl", 24*time.Hour, "How long Vault is not contacted for certificates unchanged since they were written. 0 disables the cache.")
+	flag.IntVar(&vaultOpts.KVVersion, "vault-kv-version", 0, "Version of the KV engine, 1 or 2. Detected from the mount of the engine if not given, which requires read access to sys/mounts.")
+	flag.StringVar(&vaultOpts.Auth.Method, "vault-auth-method", vault.AuthAppRole, "The method to authenticate with Vault. One of "+strings.Join(vault.AuthMethods, ", ")+".")
+	flag.StringVar(&vaultOpts.Auth.Mount, "vault-auth-mount", "", "The path the auth method is mounted at in Vault. Defaults to the name of the method.")
+	flag.StringVar(&vaultOpts.Auth.Role, "vault-auth-role", "", "The role to log in with. Required for the kubernetes and jwt auth methods.")
+	flag.StringVar(&vaultOpts.Auth.TokenFile, "vault-auth-token-file", "", "The file containing the JWT for the kubernetes and jwt auth methods or the Vault token for the token auth method. Defaults to the service account token for the kubernetes auth method.")
 
 	flag.StringVar(&controllerOpts.Namespace, "namespace", "kube-system", "The namespace in which certificate request will be created. Is overwritten by the namespace this controller runs in.")
 	flag.StringVar(&controllerOpts.ConfigFileName, "config-file-name", "git-cert-shim.yaml", "The file containing the certificate configuration.")
 	flag.StringVar(&controllerOpts.DefaultIssuer.Name, "default-issuer-name", "", "The name of the issuer used to sign certificate requests.")
 	flag.StringVar(&controllerOpts.DefaultIssuer.Kind, "default-issuer-kind", "", "The kind of the issuer used to sign certificate requests.")
 	flag.StringVar(&controllerOpts.DefaultIssuer.Group, "default-issuer-group", "", "The group of the issuer used to sign certificate requests.")
+	flag.DurationVar(&controllerOpts.MinCertificateValidity, "min-certificate-validity", 0, "Do not publish certificates that expire within this duration. Expired certificates are never published.")
+	flag.Func("chain-outputs", "Comma separated outputs of the certificate chain written to Git and Vault in addition to the certificate and key. Any of ca, chain (intermediates) and fullchain.", func(v string) error {
+		controllerOpts.ChainOutputs = strings.Split(v, ",")
+		return certificate.ValidateChainOutputs(controllerOpts.ChainOutputs)
+	})
+	flag.BoolVar(&controllerOpts.IncludeRootInChain, "chain-include-root", false, "Include the root CA in the fullchain output.")
+	flag.StringVar(&controllerOpts.CommitMessageTemplate, "git-commit-message-template", certificate.DefaultCommitMessageTemplate, "The Go template of the message used when committing a certificate. See the README for the available fields.")
+	flag.StringVar(&controllerOpts.Encryption.Scope, "encrypt-files", "", "Encrypt files in Git for the age recipients in the format of SOPS. Either keys, encrypting only files containing private keys, or all.")
+	flag.Func("encrypt-age-recipients", "Comma separated age recipients files in Git are encrypted for. Folders can configure other recipients.", func(v string) error {
+		controllerOpts.Encryption.AgeRecipients = strings.Split(v, ",")
+		return controllerOpts.Encryption.Validate()
+	})
+	flag.BoolVar(&controllerOpts.PublicOnly, "git-public-only", false, "Write only the certificate and chain to Git and the private key to Vault only. Requires --vault-push-certs.")
+	flag.StringVar(&controllerOpts.AgeIdentityFile, "decrypt-age-identity-file", "", "A file containing age identities to decrypt files in Git. Avoids re-encrypting unchanged files. Required to encrypt all files.")
+	flag.StringVar(&controllerOpts.DomainPolicyFile, "domain-policy-file", "", "A file restricting the domains certificates may be requested for by the folder containing the configuration. All domains are allowed if empty.")
 	flag.DurationVar(&controllerOpts.RenewCertificatesBefore, "renew-certificates-before", 720*time.Hour, "*Warning*: Only allows min, hour. Trigger renewal of the certificate if they would expire in less than the configured duration.")
 
 	flag.BoolVar(&debug, "debug", false, "Set debug log level.")
@@ -100,6 +178,24 @@ func main() {
 	}
 	ctrl.SetLogger(zap.New(zap.UseDevMode(true), zap.Level(&level)))
 
+	if vaultMetadataFile != "" {
+		metadata, err := vault.ReadMetadataFile(vaultMetadataFile)
+		if err != nil {
+			setupLog.Error(err, "unable to read Vault metadata", "file", vaultMetadataFile)
+			os.Exit(1)
+		}
+		vaultOpts.Metadata = metadata
+	}
+
+	if vaultTargetsFile != "" && !vaultOpts.PushCertificates {
+		setupLog.Error(errors.New("--vault-targets-file requires --vault-push-certs"), "invalid options")
+		os.Exit(1)
+	}
+	if controllerOpts.PublicOnly && (!vaultOpts.PushCertificates || vaultOpts.Payload != nil && !vaultOpts.HasField(vault.KeyPrivateKey)) {
+		setupLog.Error(errors.New("--git-public-only requires --vault-push-certs with the private-key in the --vault-payload"), "invalid options")
+		os.Exit(1)
+	}
+
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
 		Scheme: scheme,
 		Metrics: server.Options{
@@ -129,22 +225,89 @@ func main() {
 		os.Exit(1)
 	}
 
+	var repositories []*config.RepositoryOptions
+	if repositoriesConfigFile != "" {
+		repositories, err = config.ReadRepositoriesConfig(repositoriesConfigFile, &gitOpts)
+		if err != nil {
+			setupLog.Error(err, "unable to read repositories configuration", "file", repositoriesConfigFile)
+			os.Exit(1)
+		}
+	}
+
 	vaultClient, err := vault.NewClientIfSelected(vaultOpts)
 	if err != nil {
 		setupLog.Error(err, "unable to create Vault client")
 		os.Exit(1)
 	}
+	if vaultClient != nil {
+		if err := mgr.Add(manager.RunnableFunc(vaultClient.WatchToken)); err != nil {
+			setupLog.Error(err, "unable to watch Vault token")
+			os.Exit(1)
+		}
+		if vaultOpts.DriftCheckInterval > 0 {
+			if err := mgr.Add(manager.RunnableFunc(vaultClient.WatchDrift)); err != nil {
+				setupLog.Error(err, "unable to watch Vault secrets for drift")
+				os.Exit(1)
+			}
+		}
+	}
 
-	if err = (&controllers.GitController{
+	var vaultTargets []*vault.Client
+	if vaultTargetsFile != "" {
+		targets, err := vault.ReadTargetsFile(vaultTargetsFile, vaultOpts)
+		if err != nil {
+			setupLog.Error(err, "unable to read Vault targets", "file", vaultTargetsFile)
+			os.Exit(1)
+		}
+		// Unlike the primary Vault, targets unavailable at startup are logged in to in the background.
+		for _, opts := range targets {
+			target, err := vault.NewClient(opts)
+			if err != nil {
+				setupLog.Error(err, "invalid Vault target", "vault", opts.Name)
+				os.Exit(1)
+			}
+			if err := mgr.Add(manager.RunnableFunc(target.WatchToken)); err != nil {
+				setupLog.Error(err, "unable to watch Vault token", "vault", opts.Name)
+				os.Exit(1)
+			}
+			if opts.DriftCheckInterval > 0 {
+				if err := mgr.Add(manager.RunnableFunc(target.WatchDrift)); err != nil {
+					setupLog.Error(err, "unable to watch Vault secrets for drift", "vault", opts.Name)
+					os.Exit(1)
+				}
+			}
+			vaultTargets = append(vaultTargets, target)
+		}
+	}
+
+	gitController := &controllers.GitController{
 		ControllerOptions: &controllerOpts,
 		GitOptions:        &gitOpts,
+		OutputGitOptions:  &outputGitOpts,
+		Repositories:      repositories,
+		GitCertSources:    watchGitCertSources,
 		VaultClient:       vaultClient,
+		VaultTargets:      vaultTargets,
 		Log:               ctrl.Log.WithName("controllers").WithName("git"),
-	}).SetupWithManager(mgr); err != nil {
+	}
+	if err = gitController.SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "git")
 		os.Exit(1)
 	}
 
+	if watchGitCertSources {
+		if err = (&controllers.GitCertSourceReconciler{
+			GitController:  gitController,
+			GitOptions:     &gitOpts,
+			VaultOptions:   &vaultOpts,
+			VaultKVEngines: gitCertSourceVaultKVEngines,
+			Log:            ctrl.Log.WithName("controllers").WithName("gitcertsource"),
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "gitcertsource")
+			os.Exit(1)
+		}
+	}
+
 	// +kubebuilder:scaffold:builder
 
 	setupLog.Info("starting manager")
@@ -153,3 +316,65 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+// runCheck checks the certificate configuration below a folder against the domain policy without a cluster, e.g. in CI.
+func runCheck(args []string) int {
+	flags := flag.NewFlagSet(programName+" check", flag.ExitOnError)
+	configFileName := flags.String("config-file-name", "git-cert-shim.yaml", "The file containing the certificate configuration.")
+	policyFile := flags.String("domain-policy-file", "", "The file restricting the domains certificates may be requested for by folder.")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s check --domain-policy-file <file> [<folder>]\n\n", programName)
+		fmt.Fprintln(flags.Output(), "Checks the certificate configuration below the folder, defaulting to the current one, against the domain policy.")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args) //nolint:errcheck
+
+	root := "."
+	if flags.NArg() > 0 {
+		root = flags.Arg(0)
+	}
+	if *policyFile == "" {
+		flags.Usage()
+		return 2
+	}
+
+	p, err := policy.ReadFile(*policyFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return 2
+	}
+
+	files, err := util.FindFilesInPath(root, *configFileName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to find files named %s in %s: %s\n", *configFileName, root, err.Error())
+		return 2
+	}
+
+	var certificates, violations int
+	for _, file := range files {
+		certs, err := certificate.ReadCertificateConfig(file)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", file, err.Error())
+			violations++
+			continue
+		}
+		for _, c := range certs {
+			certificates++
+			if err := p.CheckCertificate(root, c); err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %s\n", file, err.Error())
+				violations++
+			}
+			if err := c.CheckPaths(root, nil); err != nil {
+				fmt.Fprintf(os.Stderr, "%s: certificate %s: %s\n", file, c.GetName(), err.Error())
+				violations++
+			}
+		}
+	}
+
+	if violations > 0 {
+		fmt.Fprintf(os.Stderr, "found %d problem(s) in %d files\n", violations, len(files))
+		return 1
+	}
+	fmt.Printf("%d certificates in %d files comply with the domain policy\n", certificates, len(files))
+	return 0
+}
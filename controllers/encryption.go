@@ -0,0 +1,105 @@
+// SPDX-FileCopyrightText: 2020 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"bytes"
+	"errors"
+	"time"
+
+	"filippo.io/age"
+
+	"github.com/sapcc/git-cert-shim/pkg/certificate"
+	"github.com/sapcc/git-cert-shim/pkg/sops"
+)
+
+// fileEncryption encrypts the files of a certificate in Git, if configured.
+type fileEncryption struct {
+	certificate.Encryption
+	// identities decrypt existing files to check whether they are up to date. Optional when only keys are encrypted.
+	identities []age.Identity
+}
+
+// encryption returns the encryption of the files of the certificate.
+func (r *repository) encryption(cert *certificate.Certificate) (fileEncryption, error) {
+	e := fileEncryption{Encryption: cert.Encryption.Merge(r.Encryption), identities: r.ageIdentities}
+	switch {
+	case e.Scope == "":
+		return e, nil
+	case len(e.AgeRecipients) == 0:
+		return e, errors.New("encryption requires age recipients")
+	case e.Scope == certificate.EncryptAll && len(e.identities) == 0:
+		// Otherwise, a renewed certificate could not be told apart from the one in the repository.
+		return e, errors.New("encrypting all files requires an age identity to decrypt them")
+	}
+	return e, nil
+}
+
+// plaintext returns the decrypted content of a file. Content not encrypted is returned as is.
+// Returns false if the content cannot be decrypted for lack of an identity.
+func (e fileEncryption) plaintext(content []byte) ([]byte, bool) {
+	if !sops.IsEncrypted(content) {
+		return content, true
+	}
+	if len(e.identities) == 0 {
+		return nil, false
+	}
+	plaintext, err := sops.Decrypt(content, e.identities)
+	if err != nil {
+		// E.g. modified, so it does not match the expected content either.
+		return content, true
+	}
+	return plaintext, true
+}
+
+// compareFiles compares the certificate and key files in the repository with the issued certificate and key
+// and returns the plaintext of the certificate file. A key file that cannot be decrypted is assumed to belong
+// to the certificate file, if it is encrypted for the configured recipients.
+func (e fileEncryption) compareFiles(fileCertByte, fileKeyByte, certByte, keyByte []byte) (certificate.FileState, []byte) {
+	fileCertPlain, isCertKnown := e.plaintext(fileCertByte)
+	fileKeyPlain, isKeyKnown := e.plaintext(fileKeyByte)
+	switch {
+	case !isCertKnown:
+		return certificate.FilesOutdated, nil
+	case !isKeyKnown && bytes.Equal(fileCertPlain, certByte) && sops.IsEncryptedFor(fileKeyByte, e.AgeRecipients):
+		return certificate.FilesUnchanged, fileCertPlain
+	case !isKeyKnown:
+		return certificate.FilesOutdated, fileCertPlain
+	}
+	return certificate.CompareFiles(fileCertPlain, fileKeyPlain, certByte, keyByte), fileCertPlain
+}
+
+// compareCertificateFile compares the certificate file in the repository with the issued certificate and returns
+// its plaintext. Used if the key is not written to the repository.
+func (e fileEncryption) compareCertificateFile(fileCertByte, certByte []byte) (certificate.FileState, []byte) {
+	fileCertPlain, isCertKnown := e.plaintext(fileCertByte)
+	if !isCertKnown {
+		return certificate.FilesOutdated, nil
+	}
+	return certificate.CompareCertificateFile(fileCertPlain, certByte), fileCertPlain
+}
+
+// isCurrent returns whether the existing content of a file holds the given content, encrypted if required.
+// Encrypted files that cannot be decrypted are considered current if assumeCurrent is set.
+func (e fileEncryption) isCurrent(existing []byte, f outputFile, assumeCurrent bool) bool {
+	if !e.IsEncrypted(f.containsKey) {
+		return f.isContent(existing)
+	}
+	if !sops.IsEncryptedFor(existing, e.AgeRecipients) {
+		return false
+	}
+	plaintext, ok := e.plaintext(existing)
+	if !ok {
+		return assumeCurrent
+	}
+	return f.isContent(plaintext)
+}
+
+// encode returns the content written to the file.
+func (e fileEncryption) encode(f outputFile) ([]byte, error) {
+	if !e.IsEncrypted(f.containsKey) {
+		return f.content, nil
+	}
+	return sops.Encrypt(f.content, e.AgeRecipients, time.Now())
+}
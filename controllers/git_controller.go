@@ -4,11 +4,13 @@
 package controllers
 
 import (
+	"bytes"
 	"context"
+	"encoding/base64"
 	"errors"
 	"fmt"
-	"path/filepath"
-	"strings"
+	"os"
+	"slices"
 	"sync"
 	"time"
 
@@ -19,6 +21,7 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/events"
 	"k8s.io/client-go/util/workqueue"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -33,18 +36,31 @@ import (
 
 // +kubebuilder:rbac:groups=cert-manager.io,resources=certificates,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=core,resources=configmaps;secrets,verbs=create;get;list;update;patch;watch;delete
+// +kubebuilder:rbac:groups=events.k8s.io,resources=events,verbs=create;patch
 
 type GitController struct {
 	ControllerOptions *config.ControllerOptions
 	GitOptions        *git.Options
-	VaultClient       *vault.Client
-	Log               logr.Logger
-	client            client.Client
-	scheme            *runtime.Scheme
-	repositorySyncer  *git.RepositorySyncer
-	queue             workqueue.TypedRateLimitingInterface[any]
-	wg                sync.WaitGroup
-	mtx               sync.Mutex
+	// OutputGitOptions configure a separate repository or branch certificates are written to.
+	// Certificates are written to the repository containing the configuration if both are the same.
+	OutputGitOptions *git.Options
+	// Repositories are handled instead of the single repository configured by GitOptions, if given.
+	Repositories []*config.RepositoryOptions
+	// GitCertSources enables handling repositories configured via GitCertSource resources.
+	// The single repository configured by GitOptions is only handled if a remote URL was given.
+	GitCertSources bool
+	VaultClient    *vault.Client
+	// VaultTargets are additional Vaults certificates are replicated to.
+	VaultTargets    []*vault.Client
+	Log             logr.Logger
+	client          client.Client
+	recorder        events.EventRecorder
+	scheme          *runtime.Scheme
+	repositories    map[string]*repository
+	repositoriesMtx sync.RWMutex
+	started         bool
+	queue           workqueue.TypedRateLimitingInterface[any]
+	wg              sync.WaitGroup
 }
 
 func (g *GitController) Start(ctx context.Context) error {
@@ -57,24 +73,22 @@ func (g *GitController) Start(ctx context.Context) error {
 
 	go wait.Until(g.runWorker, time.Second, ctx.Done())
 
-	g.requeueAll()
-	go func() {
-		ticker := time.NewTicker(g.GitOptions.SyncPeriod)
-		defer ticker.Stop()
-
-		for {
-			select {
-			case <-ticker.C:
-				g.requeueAll()
-				g.Log.Info("requeued all certificates", "syncPeriod", g.GitOptions.SyncPeriod)
-			case <-ctx.Done():
-				return
-			}
-		}
-	}()
+	g.repositoriesMtx.Lock()
+	g.started = true
+	for _, r := range g.repositories {
+		r.start(g.requeueAll)
+	}
+	g.repositoriesMtx.Unlock()
 
 	<-ctx.Done()
 	g.Log.Info("stopping controller")
+
+	g.repositoriesMtx.Lock()
+	g.started = false
+	for _, r := range g.repositories {
+		r.stop()
+	}
+	g.repositoriesMtx.Unlock()
 	return nil
 }
 
@@ -92,19 +106,30 @@ func (g *GitController) processNextWorkItem() bool {
 	err := func(obj any) error {
 		defer g.queue.Done(obj)
 
-		c, ok := obj.(*certificate.Certificate)
+		q, ok := obj.(queuedCertificate)
 		if !ok {
 			g.queue.Forget(obj)
 			utilruntime.HandleError(fmt.Errorf("expected certificate in queue but got %#v", obj))
 			return nil
 		}
+		r, c := q.repository, q.Certificate
 
-		if err := g.checkCertificate(c); err != nil {
-			g.queue.AddRateLimited(c)
+		done, ok := g.useRepository(r)
+		if !ok {
+			g.queue.Forget(q)
+			g.Log.Info("ignoring certificate of removed repository", "host", c.CommonName, "repository", c.Repository)
+			return nil
+		}
+		defer done()
+
+		err := g.checkCertificate(r, c)
+		r.setCertificateResult(c, err)
+		if err != nil {
+			g.queue.AddRateLimited(q)
 			return fmt.Errorf("error syncing certificate for host %s: %s, requeuing", c.CommonName, err.Error())
 		}
 
-		g.queue.Forget(c)
+		g.queue.Forget(q)
 		g.Log.Info("successfully synced certificate", "host", c.CommonName)
 		return nil
 	}(itm)
@@ -117,21 +142,21 @@ func (g *GitController) processNextWorkItem() bool {
 	return true
 }
 
-func (g *GitController) checkCertificate(cert *certificate.Certificate) error {
+func (g *GitController) checkCertificate(r *repository, cert *certificate.Certificate) error {
 	ctx := context.Background()
-	logger := g.Log.WithValues("host", cert.CommonName)
+	logger := g.Log.WithValues("host", cert.CommonName, "repository", r.Name)
 
-	logger.Info("ensuring certificate exists in cluster", "namespace", g.ControllerOptions.Namespace, "name", cert.GetName())
-	c, err := k8sutils.EnsureCertificate(ctx, g.client, g.ControllerOptions.Namespace, cert.GetName(), func(c *certmanagerv1.Certificate) *certmanagerv1.Certificate {
-		c.Spec.IssuerRef = g.ControllerOptions.DefaultIssuer
+	logger.Info("ensuring certificate exists in cluster", "namespace", r.Namespace, "name", cert.GetName())
+	c, err := k8sutils.EnsureCertificate(ctx, g.client, r.Namespace, cert.GetName(), func(c *certmanagerv1.Certificate) *certmanagerv1.Certificate {
+		c.Spec.IssuerRef = r.DefaultIssuer
 		c.Spec.CommonName = cert.CommonName
 		c.Spec.DNSNames = cert.SANS
 		c.Spec.SecretName = cert.GetSecretName()
-		c.Spec.RenewBefore = &metav1.Duration{Duration: g.ControllerOptions.RenewCertificatesBefore}
+		c.Spec.RenewBefore = &metav1.Duration{Duration: r.RenewCertificatesBefore}
 		return c
 	})
 	if err != nil {
-		logger.Error(err, "failed to ensure certificate", "namespace", g.ControllerOptions.Namespace, "name", cert.GetName())
+		logger.Error(err, "failed to ensure certificate", "namespace", r.Namespace, "name", cert.GetName())
 		return err
 	}
 
@@ -141,58 +166,352 @@ func (g *GitController) checkCertificate(cert *certificate.Certificate) error {
 		return errors.New("certificate not (yet) ready. re-adding to queue")
 	}
 
-	tlsSecret, err := k8sutils.GetSecret(ctx, g.client, g.ControllerOptions.Namespace, cert.GetSecretName())
+	tlsSecret, err := k8sutils.GetSecret(ctx, g.client, r.Namespace, cert.GetSecretName())
 	if err != nil {
-		logger.Error(err, "failed to get secret", "namespace", g.ControllerOptions.Namespace, "name", cert.GetSecretName())
+		logger.Error(err, "failed to get secret", "namespace", r.Namespace, "name", cert.GetSecretName())
 		return err
 	}
 
-	_, certByte, keyByte, err := certificate.ExtractCAAndCertificateAndPrivateKeyFromSecret(tlsSecret)
+	caByte, certByte, keyByte, err := certificate.ExtractCAAndCertificateAndPrivateKeyFromSecret(tlsSecret)
 	if err != nil {
-		logger.Error(err, "failed to extract certificates and key from secret", "namespace", g.ControllerOptions.Namespace, "name", cert.GetSecretName())
+		logger.Error(err, "failed to extract certificates and key from secret", "namespace", r.Namespace, "name", cert.GetSecretName())
 		return err
 	}
 
-	if g.VaultClient != nil {
-		err := g.VaultClient.UpdateCertificate(vault.CertificateData{
-			VaultPath: cert.VaultPath,
-			CertBytes: certByte,
-			KeyBytes:  keyByte,
-		}, c.Status)
-		if err != nil {
-			logger.Error(err, "failed to write certificate to Vault", "namespace", g.ControllerOptions.Namespace, "name", cert.GetSecretName())
-			return err
+	// Do not publish the certificate anywhere, if it is not usable.
+	if err := cert.Verify(caByte, certByte, keyByte, r.MinCertificateValidity, time.Now()); err != nil {
+		logger.Error(err, "refusing to publish certificate", "namespace", r.Namespace, "name", cert.GetSecretName())
+		r.recordWarning(cert.GetName(), "VerificationFailed", "PublishCertificate", err.Error())
+		return err
+	}
+
+	chain, err := certificate.NewChain(caByte, certByte, r.IncludeRootInChain)
+	if err != nil {
+		logger.Error(err, "failed to build chain", "namespace", r.Namespace, "name", cert.GetSecretName())
+		return err
+	}
+	outputs := r.chainOutputs(chain)
+
+	formats, err := g.formatOutputs(ctx, r, cert, certByte, keyByte)
+	if err != nil {
+		logger.Error(err, "failed to encode certificate", "namespace", r.Namespace, "name", cert.GetSecretName())
+		return err
+	}
+	for _, f := range formats {
+		if outputs == nil {
+			outputs = make(map[string][]byte, len(formats))
+		}
+		outputs[f.Format] = f.vaultContent()
+	}
+
+	data := vault.CertificateData{
+		CertBytes:  certByte,
+		KeyBytes:   keyByte,
+		Chain:      chain,
+		Outputs:    outputs,
+		IsOutput:   isFormatOutput(formats),
+		Metadata:   cert.VaultMetadata,
+		Owners:     cert.Owners,
+		Repository: r.Name,
+	}
+	// Every Vault is attempted, so failing ones do not block the others. Git is only written if the primary Vault
+	// holds the certificate.
+	var (
+		vaultErrs       []error
+		isPrimaryFailed bool
+	)
+	for _, vaultClient := range r.vaultClients() {
+		if err := updateVault(vaultClient.WithNamespace(cert.VaultNamespace), cert, data, c.Status); err != nil {
+			logger.Error(err, "failed to write certificate to Vault", "vault", vaultClient.Options.Name, "namespace", r.Namespace, "name", cert.GetSecretName())
+			vaultErrs = append(vaultErrs, fmt.Errorf("vault %s: %w", vaultClient.Options.Name, err))
+			isPrimaryFailed = isPrimaryFailed || vaultClient == r.vaultClient
 		}
 	}
+	vaultErr := errors.Join(vaultErrs...)
+	if isPrimaryFailed {
+		return vaultErr
+	}
+
+	if r.Git.PushCertificates {
+		if err := g.pushToGit(r, cert, logger, certByte, keyByte, outputs, formats); err != nil {
+			return errors.Join(err, vaultErr)
+		}
+	}
+
+	return vaultErr
+}
+
+// pushToGit writes the files of the certificate to the repository, if they changed.
+func (g *GitController) pushToGit(r *repository, cert *certificate.Certificate, logger logr.Logger, certByte, keyByte []byte, outputs map[string][]byte, formats []formatOutput) error {
+	// Wait for syncer to finish
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
 
-	if g.GitOptions.PushCertificates {
-		// Wait for syncer to finish
-		g.mtx.Lock()
-		defer g.mtx.Unlock()
+	// The key is only written to Vault, so it must not get lost.
+	isPublicOnly := r.PublicOnly || cert.PublicOnly
+	if isPublicOnly && !isKeyPushedToVault(r.vaultClient) {
+		return errors.New("writing only the public certificate to Git requires pushing certificates including the private key to Vault")
+	}
+
+	enc, err := r.encryption(cert)
+	if err != nil {
+		return err
+	}
+	certFileName, err := r.outputPath(cert.CertFile)
+	if err != nil {
+		return err
+	}
+	keyFileName, err := r.outputPath(cert.KeyFile)
+	if err != nil {
+		return err
+	}
 
-		certFileName := filepath.Join(cert.OutFolder, cert.CommonName+".pem")
-		certFileName = strings.ReplaceAll(certFileName, "*", "wildcard")
-		if err := util.WriteToFileIfNotEmpty(certFileName, certByte); err != nil {
+	// Additional outputs are written next to the certificate.
+	outputFiles := make([]outputFile, 0, 2+len(outputs)+len(formats))
+	outputFiles = append(outputFiles, outputFile{name: certFileName, content: certByte})
+	// Files containing the key are removed from the repository in public-only mode.
+	var removedFiles []string
+	if isPublicOnly {
+		pointerFileName, err := r.outputPath(cert.KeyPointerFile)
+		if err != nil {
 			return err
 		}
-
-		keyFileName := filepath.Join(cert.OutFolder, cert.CommonName+"-key.pem")
-		keyFileName = strings.ReplaceAll(keyFileName, "*", "wildcard")
-		if err := util.WriteToFileIfNotEmpty(keyFileName, keyByte); err != nil {
+		pointer, err := certificate.KeyPointer{Vault: certificate.VaultLocation{
+			Namespace: r.vaultClient.WithNamespace(cert.VaultNamespace).Options.Namespace,
+			Engine:    r.vaultClient.Options.KVEngineName,
+			Path:      cert.VaultPath,
+			Key:       r.vaultClient.Options.KeyName(vault.KeyPrivateKey),
+		}}.Marshal()
+		if err != nil {
+			return err
+		}
+		outputFiles = append(outputFiles, outputFile{name: pointerFileName, content: pointer})
+		removedFiles = existingFiles(keyFileName)
+	} else {
+		outputFiles = append(outputFiles, outputFile{name: keyFileName, content: keyByte, containsKey: true})
+	}
+	for _, name := range r.ChainOutputs {
+		if content, ok := outputs[name]; ok {
+			fileName, err := r.outputPath(cert.ChainFiles[name])
+			if err != nil {
+				return err
+			}
+			outputFiles = append(outputFiles, outputFile{name: fileName, content: content})
+		}
+	}
+	for _, f := range formats {
+		fileName, err := r.outputPath(cert.OutputFile(f.Output))
+		if err != nil {
 			return err
 		}
+		if isPublicOnly && f.ContainsKey() {
+			removedFiles = append(removedFiles, existingFiles(fileName)...)
+			continue
+		}
+		outputFiles = append(outputFiles, outputFile{name: fileName, content: f.content, containsKey: f.ContainsKey(), isEncoding: f.isEncoding})
+	}
+
+	// The content of the files currently in the repository. Missing files are fine.
+	fileCertByte, _ := os.ReadFile(certFileName) //nolint:errcheck
+	var state certificate.FileState
+	if isPublicOnly {
+		state, fileCertByte = enc.compareCertificateFile(fileCertByte, certByte)
+	} else {
+		fileKeyByte, _ := os.ReadFile(keyFileName) //nolint:errcheck
+		state, fileCertByte = enc.compareFiles(fileCertByte, fileKeyByte, certByte, keyByte)
+	}
+	changedFiles := changedFiles(enc, outputFiles, state == certificate.FilesUnchanged)
+	if len(changedFiles) == 0 && len(removedFiles) == 0 {
+		logger.V(1).Info("certificate in repository is up to date")
+		return nil
+	}
+
+	comparedFiles := []string{certFileName, keyFileName}
+	if isPublicOnly {
+		comparedFiles = comparedFiles[:1]
+	}
+	isModified, err := r.isModifiedOutside(state, comparedFiles...)
+	if err != nil {
+		return err
+	}
+	if isModified {
+		logger.Info("restoring certificate modified outside of git-cert-shim", "file", certFileName, "state", state.String())
+		modifiedCertificatesTotal.WithLabelValues(r.Name).Inc()
+		r.recordWarning(cert.GetName(), "CertificateModified", "RestoreCertificate",
+			fmt.Sprintf("certificate for %s in the repository was modified outside of git-cert-shim and is restored", cert.CommonName))
+	}
 
-		err = g.repositorySyncer.AddFilesAndCommit(
-			"added certificate for "+cert.CommonName, certFileName, keyFileName,
-		)
+	commitMessage, err := r.commitMessage(cert, certByte, fileCertByte, isModified)
+	if err != nil {
+		return err
+	}
+	files := make([]string, 0, len(changedFiles)+len(removedFiles))
+	for _, name := range removedFiles {
+		if err := os.Remove(name); err != nil {
+			return err
+		}
+		files = append(files, name)
+	}
+	for _, f := range changedFiles {
+		content, err := enc.encode(f)
 		if err != nil {
+			return fmt.Errorf("failed to encrypt %s: %w", f.name, err)
+		}
+		if err := util.WriteToFileIfNotEmpty(f.name, content); err != nil {
 			return err
 		}
+		files = append(files, f.name)
+	}
+
+	err = r.outputRepositorySyncer().AddFilesAndCommit(commitMessage, files...)
+	if err != nil {
+		return err
 	}
 
 	return nil
 }
 
+// formatOutput is the certificate encoded in an additional format.
+type formatOutput struct {
+	certificate.Output
+	content []byte
+	// isEncoding returns whether content holds the same certificate and key, see certificate.Output.IsEncoding.
+	isEncoding func(content []byte) bool
+}
+
+// vaultContent returns the content stored in Vault. Binary formats are base64 encoded.
+func (f formatOutput) vaultContent() []byte {
+	if !f.IsBinary() {
+		return f.content
+	}
+	return []byte(base64.StdEncoding.EncodeToString(f.content))
+}
+
+// isVaultContent returns whether the content stored in Vault holds the same certificate and key.
+func (f formatOutput) isVaultContent(content []byte) bool {
+	if !f.IsBinary() {
+		return f.isEncoding(content)
+	}
+	decoded, err := base64.StdEncoding.DecodeString(string(content))
+	return err == nil && f.isEncoding(decoded)
+}
+
+// isFormatOutput returns whether the existing content of the output with the name in Vault holds the same
+// certificate and key. Used for vault.CertificateData.IsOutput.
+func isFormatOutput(formats []formatOutput) func(name string, existing []byte) bool {
+	return func(name string, existing []byte) bool {
+		i := slices.IndexFunc(formats, func(f formatOutput) bool { return f.Format == name })
+		return i >= 0 && formats[i].isVaultContent(existing)
+	}
+}
+
+// formatOutputs encodes the certificate in all formats configured for it.
+func (g *GitController) formatOutputs(ctx context.Context, r *repository, cert *certificate.Certificate, certByte, keyByte []byte) ([]formatOutput, error) {
+	res := make([]formatOutput, 0, len(cert.Outputs))
+	for _, o := range cert.Outputs {
+		var password string
+		if o.NeedsPassword() {
+			var err error
+			if password, err = g.outputPassword(ctx, r, cert, o.Password); err != nil {
+				return nil, fmt.Errorf("password of output %s: %w", o.Format, err)
+			}
+		}
+		isEncoding := func(content []byte) bool {
+			return o.IsEncoding(content, cert.GetName(), certByte, keyByte, password)
+		}
+		// Encodings with random salts are reused while they hold the certificate, so the Vault cache stays valid.
+		content, ok := r.encodedOutput(cert.GetName(), o.Format)
+		if !ok || !isEncoding(content) {
+			var err error
+			if content, err = o.Encode(cert.GetName(), certByte, keyByte, password); err != nil {
+				return nil, fmt.Errorf("output %s: %w", o.Format, err)
+			}
+			r.setEncodedOutput(cert.GetName(), o.Format, content)
+		}
+		res = append(res, formatOutput{Output: o, content: content, isEncoding: isEncoding})
+	}
+	return res, nil
+}
+
+// outputPassword reads the password from the secret in the namespace of the repository or from the Vault namespace
+// of the certificate.
+func (g *GitController) outputPassword(ctx context.Context, r *repository, cert *certificate.Certificate, src *certificate.PasswordSource) (string, error) {
+	if src.VaultPath != "" {
+		if r.vaultClient == nil {
+			return "", errors.New("cannot read password from Vault as Vault is not configured")
+		}
+		return r.vaultClient.WithNamespace(cert.VaultNamespace).ReadValue(src.VaultPath, src.VaultKey)
+	}
+
+	secret, err := k8sutils.GetSecret(ctx, g.client, r.Namespace, src.SecretName)
+	if err != nil {
+		return "", err
+	}
+	password, ok := secret.Data[src.SecretKey]
+	if !ok {
+		return "", fmt.Errorf("secret %s/%s has no key %s", r.Namespace, src.SecretName, src.SecretKey)
+	}
+	return string(password), nil
+}
+
+// outputFile is a file written for a certificate.
+type outputFile struct {
+	name    string
+	content []byte
+	// containsKey is set for files containing the private key.
+	containsKey bool
+	// isEncoding compares existing content instead of comparing it byte by byte, if set.
+	isEncoding func(content []byte) bool
+}
+
+// isContent returns whether the plaintext content of an existing file is the content of the file.
+func (f outputFile) isContent(content []byte) bool {
+	if f.isEncoding != nil {
+		return f.isEncoding(content)
+	}
+	return bytes.Equal(content, f.content)
+}
+
+// changedFiles returns the files that do not exist with the given content. Encrypted files that cannot be
+// decrypted are considered unchanged, if the certificate is unchanged.
+func changedFiles(enc fileEncryption, files []outputFile, isCertUnchanged bool) []outputFile {
+	var res []outputFile
+	for _, f := range files {
+		content, err := os.ReadFile(f.name)
+		if err != nil || !enc.isCurrent(content, f, isCertUnchanged) {
+			res = append(res, f)
+		}
+	}
+	return res
+}
+
+// updateVault writes the certificate to all of its paths in the Vault.
+func updateVault(vaultClient *vault.Client, cert *certificate.Certificate, data vault.CertificateData, status certmanagerv1.CertificateStatus) error {
+	for _, vaultPath := range cert.VaultPaths {
+		data.VaultPath = vaultPath
+		if err := vaultClient.UpdateCertificate(data, status); err != nil {
+			return fmt.Errorf("path %s: %w", vaultPath, err)
+		}
+	}
+	return nil
+}
+
+// isKeyPushedToVault returns whether the private key of certificates is written to Vault.
+func isKeyPushedToVault(vaultClient *vault.Client) bool {
+	return vaultClient != nil && vaultClient.Options.PushCertificates && vaultClient.Options.HasField(vault.KeyPrivateKey)
+}
+
+// existingFiles returns the given files that exist.
+func existingFiles(names ...string) []string {
+	var res []string
+	for _, name := range names {
+		if _, err := os.Stat(name); err == nil {
+			res = append(res, name)
+		}
+	}
+	return res
+}
+
 func isCertificateReady(cert *certmanagerv1.Certificate) bool {
 	for _, c := range cert.Status.Conditions {
 		if c.Type == certmanagerv1.CertificateConditionReady {
@@ -203,50 +522,260 @@ func isCertificateReady(cert *certmanagerv1.Certificate) bool {
 	return false
 }
 
-func (g *GitController) requeueAll() {
-	allFiles, err := util.FindFilesInPath(g.GitOptions.AbsLocalPath, g.ControllerOptions.ConfigFileName)
+func (g *GitController) requeueAll(r *repository) {
+	certs, err := r.readCertificates()
 	if err != nil {
-		g.Log.Error(err, "failed to recursively find files in path", "path", g.GitOptions.AbsLocalPath, "filename", g.ControllerOptions.ConfigFileName)
-		return
+		r.log.Error(err, "failed to read certificate configuration")
 	}
 
-	for _, file := range allFiles {
-		certs, err := certificate.ReadCertificateConfig(file)
-		if err != nil {
-			g.Log.Error(err, "failed to read configuration", "file", file)
+	g.enqueueCertificates(r, certs)
+	g.retireCertificates(r)
+}
+
+// retireCertificates applies the retire policies of the Vaults to the secrets of certificates no longer configured.
+// Failed ones are retried with the next requeue, also in the Vaults they were retired in already, which is harmless.
+func (g *GitController) retireCertificates(r *repository) {
+	for _, loc := range r.retiredCertificates() {
+		// Another repository writing the certificate to the same path keeps it.
+		if g.isVaultLocationUsedByOthers(r, loc) {
+			r.log.Info("not retiring certificate still configured in another repository", "namespace", loc.namespace, "path", loc.path)
+			r.setCertificateRetired(loc)
+			continue
+		}
+		var errs []error
+		for _, vaultClient := range r.vaultClients() {
+			if err := vaultClient.WithNamespace(loc.namespace).RetireCertificate(loc.path, r.Name); err != nil {
+				errs = append(errs, fmt.Errorf("vault %s: %w", vaultClient.Options.Name, err))
+			}
+		}
+		if err := errors.Join(errs...); err != nil {
+			r.log.Error(err, "failed to retire certificate, retrying with the next requeue", "namespace", loc.namespace, "path", loc.path)
 			continue
 		}
+		r.setCertificateRetired(loc)
+	}
+}
 
-		g.enqueueCertificates(certs)
+// isVaultLocationUsedByOthers returns whether a certificate of another repository is written to the location in Vault.
+func (g *GitController) isVaultLocationUsedByOthers(r *repository, loc vaultLocation) bool {
+	g.repositoriesMtx.RLock()
+	defer g.repositoriesMtx.RUnlock()
+	for _, other := range g.repositories {
+		if other != r && other.usesVaultLocation(loc) {
+			return true
+		}
 	}
+	return false
 }
 
-func (g *GitController) enqueueCertificates(certs []*certificate.Certificate) {
+// queuedCertificate is a certificate queued for the repository it was read from. Certificates queued for a
+// repository that was removed, or replaced by another one of the same name, are dropped.
+type queuedCertificate struct {
+	*certificate.Certificate
+	repository *repository
+}
+
+func (g *GitController) enqueueCertificates(r *repository, certs []*certificate.Certificate) {
 	for _, c := range certs {
-		g.queue.AddRateLimited(c)
+		g.queue.AddRateLimited(queuedCertificate{Certificate: c, repository: r})
 	}
 }
 
-func (g *GitController) SetupWithManager(mgr ctrl.Manager) error {
-	if err := g.ControllerOptions.Validate(); err != nil {
-		return err
+// useRepository marks the repository as used until done is called, so removing it waits for its certificates
+// being checked. Returns false if the repository was removed.
+func (g *GitController) useRepository(r *repository) (done func(), ok bool) {
+	g.repositoriesMtx.RLock()
+	defer g.repositoriesMtx.RUnlock()
+	if g.repositories[r.Name] != r {
+		return nil, false
+	}
+	r.wg.Add(1)
+	return r.wg.Done, true
+}
+
+func (g *GitController) getRepository(name string) *repository {
+	g.repositoriesMtx.RLock()
+	defer g.repositoriesMtx.RUnlock()
+	return g.repositories[name]
+}
+
+// addRepository clones the repository and starts handling it, if the controller was started already.
+func (g *GitController) addRepository(opts *config.RepositoryOptions, sourceVersion string) error {
+	if g.getRepository(opts.Name) != nil {
+		return fmt.Errorf("repository %s exists already", opts.Name)
 	}
 
-	g.mtx = sync.Mutex{}
-	repoSyncer, err := git.NewRepositorySyncerAndInit(ctrl.Log.WithName("gitsyncer"), g.GitOptions, &g.mtx)
+	opts.SetDefaults(g.ControllerOptions)
+	if err := opts.Validate(); err != nil {
+		return err
+	}
+	// Checked before the SSH key file of another repository could be overwritten.
+	g.repositoriesMtx.RLock()
+	err := g.checkEnvVarPrefixes(opts)
+	g.repositoriesMtx.RUnlock()
 	if err != nil {
 		return err
 	}
-	g.repositorySyncer = repoSyncer
 
-	if err := mgr.Add(repoSyncer); err != nil {
+	vaultClient := g.VaultClient
+	if opts.VaultDisabled {
+		vaultClient = nil
+	}
+	if opts.Vault != nil && vaultClient != nil {
+		vaultClient = vaultClient.WithOptions(*opts.Vault)
+	}
+	if opts.Vault != nil && opts.Vault.PushCertificates && vaultClient == nil {
+		return errors.New("cannot push certificates to Vault as Vault is not configured for the controller")
+	}
+	if opts.PublicOnly && !isKeyPushedToVault(vaultClient) {
+		return errors.New("writing only the public certificate to Git requires pushing certificates including the private key to Vault")
+	}
+
+	r, err := newRepository(ctrl.Log.WithName("repository"), opts, vaultClient)
+	if err != nil {
+		return err
+	}
+	r.sourceVersion = sourceVersion
+	r.recorder = g.recorder
+	r.vaultTargets = g.repositoryVaultTargets(opts)
+
+	g.repositoriesMtx.Lock()
+	defer g.repositoriesMtx.Unlock()
+	if _, ok := g.repositories[opts.Name]; ok {
+		return fmt.Errorf("repository %s exists already", opts.Name)
+	}
+	if err := g.checkEnvVarPrefixes(opts); err != nil {
 		return err
 	}
+	g.repositories[opts.Name] = r
+	if g.started {
+		r.start(g.requeueAll)
+	}
+	return nil
+}
+
+// checkEnvVarPrefixes rejects repositories reading environment variables of others, as they would share their
+// credentials and SSH key file, too. The caller must hold repositoriesMtx.
+func (g *GitController) checkEnvVarPrefixes(opts *config.RepositoryOptions) error {
+	for _, other := range g.repositories {
+		for _, prefix := range envVarPrefixes(opts) {
+			if slices.Contains(envVarPrefixes(other.RepositoryOptions), prefix) {
+				return fmt.Errorf("repository %s uses the environment variables %s_* of repository %s", opts.Name, prefix, other.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// envVarPrefixes returns the prefixes of the environment variables the Git options of the repository are read from.
+func envVarPrefixes(opts *config.RepositoryOptions) []string {
+	var res []string
+	for _, o := range []*git.Options{opts.Git, opts.OutputGit} {
+		if o == nil {
+			continue
+		}
+		prefix := o.EnvVarPrefix
+		if prefix == "" {
+			prefix = "GIT"
+		}
+		res = append(res, prefix)
+	}
+	return res
+}
+
+// repositoryVaultTargets returns the Vaults the certificates of the repository are replicated to, using the Vault
+// options of the repository, if any. None if the repository does not push certificates to Vault.
+func (g *GitController) repositoryVaultTargets(opts *config.RepositoryOptions) []*vault.Client {
+	if opts.VaultDisabled {
+		return nil
+	}
+	if opts.Vault == nil {
+		return g.VaultTargets
+	}
+	if !opts.Vault.PushCertificates || g.VaultClient == nil {
+		return nil
+	}
+	targets := make([]*vault.Client, 0, len(g.VaultTargets))
+	for _, target := range g.VaultTargets {
+		targets = append(targets, target.WithRepositoryOptions(*opts.Vault, g.VaultClient.Options))
+	}
+	return targets
+}
+
+// removeRepository stops handling the repository and waits until it is no longer used, so it can be added again
+// using the same local clones. Queued certificates of the repository are dropped.
+func (g *GitController) removeRepository(name string) {
+	g.repositoriesMtx.Lock()
+	r, ok := g.repositories[name]
+	if ok {
+		r.stop()
+		delete(g.repositories, name)
+		domainPolicyViolations.DeleteLabelValues(name)
+		modifiedCertificatesTotal.DeleteLabelValues(name)
+	}
+	g.repositoriesMtx.Unlock()
+
+	if ok {
+		r.wait()
+		g.unmanageVaultSecrets(r)
+	}
+}
+
+// isVaultLocationUsed returns whether a certificate of any repository is written to the location in Vault.
+// The caller must hold repositoriesMtx.
+func (g *GitController) isVaultLocationUsed(loc vaultLocation) bool {
+	for _, r := range g.repositories {
+		if r.usesVaultLocation(loc) {
+			return true
+		}
+	}
+	return false
+}
+
+// unmanageVaultSecrets stops checking the secrets written by the removed repository for drift, unless another
+// repository writes to the same location.
+func (g *GitController) unmanageVaultSecrets(r *repository) {
+	g.repositoriesMtx.RLock()
+	defer g.repositoriesMtx.RUnlock()
+	for _, loc := range r.managedVaultLocations() {
+		if g.isVaultLocationUsed(loc) {
+			continue
+		}
+		for _, c := range r.vaultClients() {
+			c.WithNamespace(loc.namespace).Unmanage(loc.path)
+		}
+	}
+}
+
+// repositoryOptions returns the options of all repositories handled by the controller from the start.
+func (g *GitController) repositoryOptions() []*config.RepositoryOptions {
+	if len(g.Repositories) > 0 {
+		return g.Repositories
+	}
+	if g.GitCertSources && !g.GitOptions.HasRemoteURL() {
+		return nil
+	}
+	return []*config.RepositoryOptions{{
+		Name:      "default",
+		Git:       g.GitOptions,
+		OutputGit: g.OutputGitOptions,
+	}}
+}
+
+func (g *GitController) SetupWithManager(mgr ctrl.Manager) error {
+	g.ControllerOptions.Namespace = util.GetEnv("NAMESPACE", g.ControllerOptions.Namespace)
+
+	g.recorder = mgr.GetEventRecorder("git-cert-shim")
+	g.repositories = make(map[string]*repository)
+	for _, opts := range g.repositoryOptions() {
+		if err := g.addRepository(opts, ""); err != nil {
+			return fmt.Errorf("repository %s: %w", opts.Name, err)
+		}
+	}
 
 	g.scheme = mgr.GetScheme()
 	g.client = mgr.GetClient()
 	g.queue = workqueue.NewTypedRateLimitingQueue(workqueue.NewTypedItemExponentialFailureRateLimiter[any](30*time.Second, 600*time.Second))
-	g.ControllerOptions.Namespace = util.GetEnv("NAMESPACE", g.ControllerOptions.Namespace)
 
 	if err := mgr.Add(g); err != nil {
 		return err
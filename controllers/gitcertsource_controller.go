@@ -0,0 +1,275 @@
+// SPDX-FileCopyrightText: 2020 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	"github.com/sapcc/git-cert-shim/api/v1alpha1"
+	"github.com/sapcc/git-cert-shim/pkg/config"
+	"github.com/sapcc/git-cert-shim/pkg/git"
+	"github.com/sapcc/git-cert-shim/pkg/k8sutils"
+	"github.com/sapcc/git-cert-shim/pkg/vault"
+)
+
+// statusRefreshInterval is the interval in which the status of GitCertSources is refreshed.
+const statusRefreshInterval = time.Minute
+
+// +kubebuilder:rbac:groups=gitcertshim.cloud.sap,resources=gitcertsources,verbs=get;list;watch
+// +kubebuilder:rbac:groups=gitcertshim.cloud.sap,resources=gitcertsources/status,verbs=get;update;patch
+
+// GitCertSourceReconciler starts and stops handling the repositories configured by GitCertSources.
+type GitCertSourceReconciler struct {
+	GitController *GitController
+	// GitOptions are used for settings not given in the GitCertSource.
+	GitOptions *git.Options
+	// VaultOptions are used for settings not given in the GitCertSource.
+	VaultOptions *vault.Options
+	// VaultKVEngines are the KV engines GitCertSources may access with the Vault identity of the controller.
+	// GitCertSources have no access to Vault if empty.
+	VaultKVEngines []string
+	Log            logr.Logger
+	client         client.Client
+}
+
+func (r *GitCertSourceReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := r.Log.WithValues("gitcertsource", req.NamespacedName)
+	name := gitCertSourceRepositoryName(req.NamespacedName)
+
+	src := new(v1alpha1.GitCertSource)
+	if err := r.client.Get(ctx, req.NamespacedName, src); err != nil {
+		if apierrors.IsNotFound(err) {
+			logger.Info("stopping to handle repository of deleted GitCertSource")
+			r.GitController.removeRepository(name)
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, err
+	}
+	if !src.DeletionTimestamp.IsZero() {
+		r.GitController.removeRepository(name)
+		return ctrl.Result{}, nil
+	}
+
+	opts, sourceVersion, err := r.repositoryOptions(ctx, src)
+	if err != nil {
+		logger.Error(err, "invalid GitCertSource")
+		return ctrl.Result{RequeueAfter: statusRefreshInterval}, r.updateStatus(ctx, src, nil, "InvalidSpec", err)
+	}
+
+	repo := r.GitController.getRepository(name)
+	if repo == nil || repo.sourceVersion != sourceVersion {
+		if repo != nil {
+			logger.Info("GitCertSource changed. restarting repository")
+		}
+		r.GitController.removeRepository(name)
+		if err := r.GitController.addRepository(opts, sourceVersion); err != nil {
+			logger.Error(err, "failed to handle repository")
+			return ctrl.Result{RequeueAfter: statusRefreshInterval}, r.updateStatus(ctx, src, nil, "InitializationFailed", err)
+		}
+		repo = r.GitController.getRepository(name)
+	}
+
+	if err := r.updateStatus(ctx, src, repo, "", nil); err != nil {
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{RequeueAfter: statusRefreshInterval}, nil
+}
+
+// repositoryOptions returns the options of the repository and a version identifying the resources they were read from.
+func (r *GitCertSourceReconciler) repositoryOptions(ctx context.Context, src *v1alpha1.GitCertSource) (*config.RepositoryOptions, string, error) {
+	name := gitCertSourceRepositoryName(client.ObjectKeyFromObject(src))
+	versions := []string{strconv.FormatInt(src.Generation, 10)}
+
+	gitOpts := config.NewRepositoryGitOptions(name, r.GitOptions)
+	gitOpts.EnvVarPrefix = gitCertSourceEnvVarPrefix(client.ObjectKeyFromObject(src))
+	gitOpts.RemoteURL = src.Spec.RemoteURL
+	if src.Spec.Branch != "" {
+		gitOpts.BranchName = src.Spec.Branch
+	}
+	if src.Spec.SyncPeriod != nil {
+		gitOpts.SyncPeriod = src.Spec.SyncPeriod.Duration
+	}
+	if src.Spec.Git.PushCertificates != nil {
+		gitOpts.PushCertificates = *src.Spec.Git.PushCertificates
+	}
+	gitOpts.DryRun = gitOpts.DryRun || src.Spec.Git.DryRun
+
+	// The credentials of the controller must not be sent to remotes chosen by others.
+	ref := src.Spec.CredentialsSecretRef
+	if ref == nil || ref.Name == "" {
+		return nil, "", errors.New("no credentialsSecretRef given")
+	}
+	version, err := r.applyCredentials(ctx, src.Namespace, ref.Name, filepath.Join(name, "credentials"), gitOpts)
+	if err != nil {
+		return nil, "", err
+	}
+	versions = append(versions, version)
+
+	opts := &config.RepositoryOptions{
+		Name: name,
+		ControllerOptions: config.ControllerOptions{
+			ConfigFileName: src.Spec.ConfigFileName,
+			Namespace:      src.Namespace,
+		},
+		Git: gitOpts,
+	}
+	if src.Spec.DefaultIssuer != nil {
+		opts.DefaultIssuer = *src.Spec.DefaultIssuer
+	}
+	if src.Spec.RenewBefore != nil {
+		opts.RenewCertificatesBefore = src.Spec.RenewBefore.Duration
+	}
+
+	if out := src.Spec.Git.Output; out != nil {
+		opts.OutputGit = &git.Options{
+			EnvVarPrefix: gitOpts.EnvVarPrefix + "_OUTPUT",
+			RemoteURL:    out.RemoteURL,
+			BranchName:   out.Branch,
+			PathPrefix:   out.Path,
+		}
+		if ref := out.CredentialsSecretRef; ref != nil {
+			version, err := r.applyCredentials(ctx, src.Namespace, ref.Name, filepath.Join(name, "output-credentials"), opts.OutputGit)
+			if err != nil {
+				return nil, "", err
+			}
+			versions = append(versions, version)
+		}
+	}
+
+	vaultOpts := *r.VaultOptions
+	if src.Spec.Vault.PushCertificates != nil {
+		vaultOpts.PushCertificates = *src.Spec.Vault.PushCertificates
+	}
+	if src.Spec.Vault.UpdateMetadata != nil {
+		vaultOpts.UpdateMetaData = *src.Spec.Vault.UpdateMetadata
+	}
+	if src.Spec.Vault.KVEngine != "" {
+		vaultOpts.KVEngineName = src.Spec.Vault.KVEngine
+	}
+
+	// Vault is accessed with the identity of the controller, so only allowed engines may be used.
+	opts.VaultNamespaceFixed = true
+	switch {
+	case slices.Contains(r.VaultKVEngines, vaultOpts.KVEngineName):
+		opts.Vault = &vaultOpts
+	case src.Spec.Vault.KVEngine != "" || src.Spec.Vault.PushCertificates != nil && *src.Spec.Vault.PushCertificates:
+		return nil, "", fmt.Errorf("GitCertSources may not use the Vault KV engine %q", vaultOpts.KVEngineName)
+	default:
+		opts.VaultDisabled = true
+	}
+
+	return opts, strings.Join(versions, "/"), nil
+}
+
+// applyCredentials reads the token or SSH private key from the secret and sets them in the given options.
+// The SSH private key is written to a file below the given path. Returns the version of the secret.
+func (r *GitCertSourceReconciler) applyCredentials(ctx context.Context, namespace, secretName, path string, opts *git.Options) (string, error) {
+	secret, err := k8sutils.GetSecret(ctx, r.client, namespace, secretName)
+	if err != nil {
+		return "", fmt.Errorf("failed to get credentials secret %s/%s: %w", namespace, secretName, err)
+	}
+
+	if token, ok := secret.Data[v1alpha1.CredentialsTokenKey]; ok {
+		opts.GithubToken = strings.TrimSpace(string(token))
+		return secret.ResourceVersion, nil
+	}
+
+	privateKey, ok := secret.Data[v1alpha1.CredentialsSSHPrivateKeyKey]
+	if !ok {
+		return "", fmt.Errorf("credentials secret %s/%s contains neither %s nor %s", namespace, secretName, v1alpha1.CredentialsTokenKey, v1alpha1.CredentialsSSHPrivateKeyKey)
+	}
+	keyFile := filepath.Join(os.TempDir(), "git-cert-shim-credentials", path)
+	if err := os.MkdirAll(filepath.Dir(keyFile), 0700); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(keyFile, privateKey, 0600); err != nil {
+		return "", err
+	}
+	opts.GithubSSHPrivkeyFilename = keyFile
+	return secret.ResourceVersion, nil
+}
+
+// updateStatus reports the state of the repository or, if the repository could not be handled, the reason and error.
+func (r *GitCertSourceReconciler) updateStatus(ctx context.Context, src *v1alpha1.GitCertSource, repo *repository, reason string, err error) error {
+	status := src.Status.DeepCopy()
+	status.ObservedGeneration = src.Generation
+
+	condition := metav1.Condition{
+		Type:               v1alpha1.ConditionReady,
+		ObservedGeneration: src.Generation,
+	}
+	switch {
+	case err != nil:
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = reason
+		condition.Message = err.Error()
+		status.Errors = []string{err.Error()}
+	case repo != nil:
+		s := repo.status()
+		status.LastSyncedCommit = s.commit
+		if !s.syncTime.IsZero() {
+			status.LastSyncTime = &metav1.Time{Time: s.syncTime}
+		}
+		status.Certificates = s.certificates
+		status.SyncedCertificates = s.syncedCertificates
+		status.FailedCertificates = s.failedCertificates
+		status.Errors = s.errs
+
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = "Synced"
+		condition.Message = fmt.Sprintf("%d of %d certificates synced", s.syncedCertificates, s.certificates)
+		if len(s.errs) > 0 {
+			condition.Status = metav1.ConditionFalse
+			condition.Reason = "Errors"
+			condition.Message = s.errs[0]
+		}
+	}
+	meta.SetStatusCondition(&status.Conditions, condition)
+
+	patch := client.MergeFrom(src.DeepCopy())
+	src.Status = *status
+	return r.client.Status().Patch(ctx, src, patch)
+}
+
+// gitCertSourceRepositoryName returns the name of the repository configured by the GitCertSource.
+func gitCertSourceRepositoryName(key types.NamespacedName) string {
+	return filepath.Join("gitcertsource", key.Namespace, key.Name)
+}
+
+// gitCertSourceEnvVarPrefix returns the prefix of the environment variables of the repository configured by the
+// GitCertSource. It also names the SSH key file, so it is derived from a hash, as replacing the characters not allowed
+// in environment variables would map several GitCertSources to the same prefix.
+func gitCertSourceEnvVarPrefix(key types.NamespacedName) string {
+	sum := sha256.Sum256([]byte(key.String()))
+	return "GIT_GITCERTSOURCE_" + strings.ToUpper(hex.EncodeToString(sum[:12]))
+}
+
+func (r *GitCertSourceReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	r.client = mgr.GetClient()
+	return ctrl.NewControllerManagedBy(mgr).
+		// Status updates do not require reconciliation. The status is refreshed periodically.
+		For(&v1alpha1.GitCertSource{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Named("gitcertsource").
+		Complete(r)
+}
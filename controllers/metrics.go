@@ -0,0 +1,29 @@
+// SPDX-FileCopyrightText: 2020 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+func init() {
+	metrics.Registry.MustRegister(domainPolicyViolations, modifiedCertificatesTotal)
+}
+
+const metricNamespace = "git_cert_shim"
+
+var (
+	domainPolicyViolations = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricNamespace,
+		Name:      "domain_policy_violations",
+		Help:      "Number of configured certificates rejected by the domain policy",
+	}, []string{"repository"})
+
+	modifiedCertificatesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricNamespace,
+		Name:      "modified_certificates_total",
+		Help:      "Counter for certificates restored in the repository after being modified outside of git-cert-shim",
+	}, []string{"repository"})
+)
@@ -0,0 +1,565 @@
+// SPDX-FileCopyrightText: 2020 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"text/template"
+	"time"
+
+	"filippo.io/age"
+	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/events"
+
+	"github.com/sapcc/git-cert-shim/pkg/certificate"
+	"github.com/sapcc/git-cert-shim/pkg/config"
+	"github.com/sapcc/git-cert-shim/pkg/git"
+	"github.com/sapcc/git-cert-shim/pkg/policy"
+	"github.com/sapcc/git-cert-shim/pkg/sops"
+	"github.com/sapcc/git-cert-shim/pkg/util"
+	"github.com/sapcc/git-cert-shim/pkg/vault"
+)
+
+// repository bundles the syncers of a repository containing certificate configuration
+// and of the repository or branch certificates are written to.
+type repository struct {
+	*config.RepositoryOptions
+	log          logr.Logger
+	syncer       *git.RepositorySyncer
+	outputSyncer *git.RepositorySyncer
+	vaultClient  *vault.Client
+	// vaultTargets are additional Vaults certificates are replicated to.
+	vaultTargets []*vault.Client
+	recorder     events.EventRecorder
+	// commitMessageTpl renders the message used when committing a certificate.
+	commitMessageTpl *template.Template
+	// ageIdentities decrypt files in Git, if configured.
+	ageIdentities []age.Identity
+	// sourceVersion identifies the version of the resources the repository was configured from.
+	sourceVersion string
+	// mtx guards the local clones against concurrent use by the syncers and the controller.
+	mtx    sync.Mutex
+	cancel context.CancelFunc
+	// wg tracks the goroutines of the repository and the workers checking its certificates, see wait.
+	wg sync.WaitGroup
+
+	statusMtx          sync.Mutex
+	readErr            error
+	certificateResults map[string]error
+	// vaultLocations are the locations of the configured certificates in Vault by the configuration file they are
+	// configured in. Nil until read for the first time.
+	vaultLocations map[vaultLocation]string
+	// retiredVaultLocations are no longer configured and still to be retired in Vault.
+	retiredVaultLocations map[vaultLocation]bool
+
+	encodedOutputsMtx sync.Mutex
+	// encodedOutputs are the last encodings of the outputs of the certificates by name and format.
+	encodedOutputs map[string][]byte
+}
+
+// vaultLocation is a path certificates are written to in Vault.
+type vaultLocation struct {
+	namespace string
+	path      string
+}
+
+// repositoryStatus summarizes the state of a repository.
+type repositoryStatus struct {
+	commit             string
+	syncTime           time.Time
+	certificates       int
+	syncedCertificates int
+	failedCertificates int
+	errs               []string
+}
+
+var errNotSyncedYet = errors.New("not synced yet")
+
+// maxStatusErrors limits the number of errors reported in a repositoryStatus.
+const maxStatusErrors = 10
+
+// newRepository clones the repository and, if configured, the separate output repository.
+func newRepository(logger logr.Logger, opts *config.RepositoryOptions, vaultClient *vault.Client) (*repository, error) {
+	r := &repository{
+		RepositoryOptions:     opts,
+		log:                   logger.WithValues("repository", opts.Name),
+		vaultClient:           vaultClient,
+		certificateResults:    make(map[string]error),
+		retiredVaultLocations: make(map[vaultLocation]bool),
+		encodedOutputs:        make(map[string][]byte),
+	}
+
+	tplText := opts.CommitMessageTemplate
+	if tplText == "" {
+		tplText = certificate.DefaultCommitMessageTemplate
+	}
+	tpl, err := certificate.ParseCommitMessageTemplate(tplText)
+	if err != nil {
+		return nil, err
+	}
+	r.commitMessageTpl = tpl
+
+	if opts.AgeIdentityFile != "" {
+		if r.ageIdentities, err = sops.ReadIdentities(opts.AgeIdentityFile); err != nil {
+			return nil, fmt.Errorf("failed to read age identities: %w", err)
+		}
+	}
+
+	opts.Git.VerifiedFileName = opts.ConfigFileName
+	syncer, err := git.NewRepositorySyncerAndInit(r.log.WithName("gitsyncer"), opts.Git, &r.mtx)
+	if err != nil {
+		return nil, err
+	}
+	r.syncer = syncer
+
+	if opts.OutputGit != nil {
+		if err := opts.OutputGit.Inherit(opts.Git); err != nil {
+			return nil, err
+		}
+		if !opts.OutputGit.IsSameRepositoryAndBranch(opts.Git) {
+			outputSyncer, err := git.NewRepositorySyncerAndInit(r.log.WithName("gitsyncer").WithName("output"), opts.OutputGit, &r.mtx)
+			if err != nil {
+				return nil, err
+			}
+			r.outputSyncer = outputSyncer
+		}
+	}
+
+	return r, nil
+}
+
+// start runs the syncers and periodically calls requeue until the repository is stopped.
+func (r *repository) start(requeue func(*repository)) {
+	var ctx context.Context
+	ctx, r.cancel = context.WithCancel(context.Background())
+
+	for _, s := range []*git.RepositorySyncer{r.syncer, r.outputSyncer} {
+		if s == nil {
+			continue
+		}
+		r.wg.Go(func() {
+			if err := s.Start(ctx); err != nil {
+				r.log.Error(err, "syncer stopped with error")
+			}
+		})
+	}
+
+	r.wg.Go(func() {
+		ticker := time.NewTicker(r.Git.SyncPeriod)
+		defer ticker.Stop()
+
+		requeue(r)
+
+		for {
+			select {
+			case <-ticker.C:
+				requeue(r)
+				r.log.Info("requeued all certificates", "syncPeriod", r.Git.SyncPeriod)
+			case <-ctx.Done():
+				return
+			}
+		}
+	})
+}
+
+func (r *repository) stop() {
+	if r.cancel != nil {
+		r.cancel()
+	}
+}
+
+// wait returns once the stopped repository is no longer used, so its local clones can be replaced.
+func (r *repository) wait() {
+	r.wg.Wait()
+}
+
+// readCertificates reads the certificate configuration from all configuration files in the repository.
+// If verification of commit signatures is configured, the last trusted version of each file is used.
+func (r *repository) readCertificates() ([]*certificate.Certificate, error) {
+	trustedFiles, isVerified := r.syncer.TrustedFiles()
+	if isVerified {
+		return r.readTrustedCertificates(trustedFiles)
+	}
+
+	allFiles, err := util.FindFilesInPath(r.Git.AbsLocalPath, r.ConfigFileName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to recursively find files named %s in path %s: %w", r.ConfigFileName, r.Git.AbsLocalPath, err)
+	}
+
+	var (
+		res         []*certificate.Certificate
+		errs        []error
+		failedFiles = make(map[string]bool)
+	)
+	for _, file := range allFiles {
+		certs, err := certificate.ReadCertificateConfig(file)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to read configuration %s: %w", file, err))
+			failedFiles[file] = true
+			continue
+		}
+
+		for _, c := range certs {
+			if err := r.checkCertificate(c); err != nil {
+				errs = append(errs, fmt.Errorf("configuration %s: certificate %s: %w", file, c.GetName(), err))
+				failedFiles[file] = true
+				continue
+			}
+			c.Repository = r.Name
+			res = append(res, c)
+		}
+	}
+
+	return r.setReadCertificates(res, failedFiles, errs)
+}
+
+func (r *repository) readTrustedCertificates(files map[string]git.TrustedFile) ([]*certificate.Certificate, error) {
+	var (
+		res         []*certificate.Certificate
+		errs        []error
+		failedFiles = make(map[string]bool)
+	)
+	for file, f := range files {
+		if f.UntrustedCommit != "" {
+			errs = append(errs, fmt.Errorf("ignoring changes to configuration %s in commit %s not signed by a trusted key", file, f.UntrustedCommit))
+		}
+		if f.Content == nil {
+			continue
+		}
+
+		certs, err := certificate.ParseCertificateConfig(file, f.Content)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to read configuration %s: %w", file, err))
+			failedFiles[file] = true
+			continue
+		}
+
+		for _, c := range certs {
+			if err := r.checkCertificate(c); err != nil {
+				errs = append(errs, fmt.Errorf("configuration %s: certificate %s: %w", file, c.GetName(), err))
+				failedFiles[file] = true
+				continue
+			}
+			c.Repository = r.Name
+			res = append(res, c)
+		}
+	}
+
+	return r.setReadCertificates(res, failedFiles, errs)
+}
+
+// setReadCertificates drops the read certificates not allowed by the domain policy and records the remaining ones.
+// Configuration files are considered failed if any of their certificates is dropped.
+func (r *repository) setReadCertificates(certs []*certificate.Certificate, failedFiles map[string]bool, errs []error) ([]*certificate.Certificate, error) {
+	res, violations := r.allowedCertificates(certs)
+	for _, c := range certs {
+		if !slices.Contains(res, c) {
+			failedFiles[c.ConfigFile] = true
+		}
+	}
+	err := errors.Join(append(errs, violations...)...)
+	r.setCertificates(res, failedFiles, err)
+	return res, err
+}
+
+// checkCertificate checks the output files of the certificate and where and how it is written to Vault.
+func (r *repository) checkCertificate(c *certificate.Certificate) error {
+	if err := c.CheckPaths(r.Git.AbsLocalPath, r.ChainOutputs); err != nil {
+		return err
+	}
+	if r.VaultNamespaceFixed && c.VaultNamespace != "" {
+		return fmt.Errorf("writing to Vault namespace %s is not allowed for this repository", c.VaultNamespace)
+	}
+	outputs := slices.Clone(r.ChainOutputs)
+	for _, o := range c.Outputs {
+		outputs = append(outputs, o.Format)
+	}
+	for _, vaultClient := range r.vaultClients() {
+		if !vaultClient.Options.PushCertificates {
+			continue
+		}
+		if err := vaultClient.Options.CheckOutputs(outputs); err != nil {
+			return fmt.Errorf("vault %s: %w", vaultClient.Options.Name, err)
+		}
+	}
+	return nil
+}
+
+// allowedCertificates drops the certificates not allowed by the domain policy, if configured.
+func (r *repository) allowedCertificates(certs []*certificate.Certificate) ([]*certificate.Certificate, []error) {
+	if r.DomainPolicyFile == "" {
+		return certs, nil
+	}
+
+	p, err := policy.ReadFile(r.DomainPolicyFile)
+	if err != nil {
+		// Rather reject all certificates than allowing any domain.
+		return nil, []error{fmt.Errorf("rejecting all certificates: %w", err)}
+	}
+
+	var (
+		res  []*certificate.Certificate
+		errs []error
+	)
+	for _, c := range certs {
+		if err := p.CheckCertificate(r.Git.AbsLocalPath, c); err != nil {
+			r.log.Info("rejecting certificate", "host", c.CommonName, "reason", err.Error())
+			// The cert-manager certificate is not created due to the violation.
+			r.recordWarning(c.GetName(), "DomainPolicyViolation", "RejectCertificate", err.Error())
+			errs = append(errs, fmt.Errorf("certificate %s: %w", c.GetName(), err))
+			continue
+		}
+		res = append(res, c)
+	}
+
+	domainPolicyViolations.WithLabelValues(r.Name).Set(float64(len(errs)))
+	return res, errs
+}
+
+// recordWarning emits a warning event for the cert-manager certificate with the given name, which might not exist.
+func (r *repository) recordWarning(name, reason, action, note string) {
+	if r.recorder == nil {
+		return
+	}
+	c := &certmanagerv1.Certificate{
+		ObjectMeta: metav1.ObjectMeta{Namespace: r.Namespace, Name: name},
+	}
+	r.recorder.Eventf(c, nil, corev1.EventTypeWarning, reason, action, "%s", note)
+}
+
+// setCertificates drops the results of certificates that are no longer configured. Certificates missing from the
+// configuration files that failed are considered still configured, so they are not retired due to an error.
+func (r *repository) setCertificates(certs []*certificate.Certificate, failedFiles map[string]bool, readErr error) {
+	r.statusMtx.Lock()
+	defer r.statusMtx.Unlock()
+
+	r.readErr = readErr
+	results := make(map[string]error, len(certs))
+	for _, c := range certs {
+		results[c.GetName()] = errNotSyncedYet
+		if err, ok := r.certificateResults[c.GetName()]; ok {
+			results[c.GetName()] = err
+		}
+	}
+	r.certificateResults = results
+
+	if r.vaultClient == nil && len(r.vaultTargets) == 0 {
+		return
+	}
+	locations := make(map[vaultLocation]string, len(certs))
+	for _, c := range certs {
+		for _, path := range c.VaultPaths {
+			if path == "" {
+				continue
+			}
+			locations[vaultLocation{namespace: c.VaultNamespace, path: path}] = c.ConfigFile
+		}
+	}
+	for loc, file := range r.vaultLocations {
+		if _, ok := locations[loc]; ok {
+			continue
+		}
+		if failedFiles[file] {
+			locations[loc] = file
+			continue
+		}
+		r.retiredVaultLocations[loc] = true
+	}
+	for loc := range locations {
+		delete(r.retiredVaultLocations, loc)
+	}
+	r.vaultLocations = locations
+}
+
+// managedVaultLocations returns the locations in Vault of the configured certificates and the ones still to be retired.
+func (r *repository) managedVaultLocations() []vaultLocation {
+	r.statusMtx.Lock()
+	defer r.statusMtx.Unlock()
+	res := slices.Collect(maps.Keys(r.vaultLocations))
+	for loc := range r.retiredVaultLocations {
+		if _, ok := r.vaultLocations[loc]; !ok {
+			res = append(res, loc)
+		}
+	}
+	return res
+}
+
+// retiredCertificates returns the locations in Vault of certificates still to be retired.
+func (r *repository) retiredCertificates() []vaultLocation {
+	r.statusMtx.Lock()
+	defer r.statusMtx.Unlock()
+	return slices.Collect(maps.Keys(r.retiredVaultLocations))
+}
+
+// usesVaultLocation returns whether a certificate configured in the repository is written to the location in Vault.
+func (r *repository) usesVaultLocation(loc vaultLocation) bool {
+	r.statusMtx.Lock()
+	defer r.statusMtx.Unlock()
+	_, ok := r.vaultLocations[loc]
+	return ok
+}
+
+// setCertificateRetired records that the certificate was retired in Vault, unless it was configured again meanwhile.
+func (r *repository) setCertificateRetired(loc vaultLocation) {
+	r.statusMtx.Lock()
+	defer r.statusMtx.Unlock()
+	delete(r.retiredVaultLocations, loc)
+}
+
+// setCertificateResult records the result of the last synchronization of the certificate.
+func (r *repository) setCertificateResult(cert *certificate.Certificate, err error) {
+	r.statusMtx.Lock()
+	defer r.statusMtx.Unlock()
+
+	if _, ok := r.certificateResults[cert.GetName()]; ok {
+		r.certificateResults[cert.GetName()] = err
+	}
+}
+
+// status summarizes the state of the repository.
+func (r *repository) status() repositoryStatus {
+	var res repositoryStatus
+	res.commit, res.syncTime, _ = r.syncer.Status()
+
+	var errs []error
+	for _, s := range []*git.RepositorySyncer{r.syncer, r.outputSyncer} {
+		if s == nil {
+			continue
+		}
+		if _, _, err := s.Status(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	r.statusMtx.Lock()
+	defer r.statusMtx.Unlock()
+
+	if r.readErr != nil {
+		errs = append(errs, r.readErr)
+	}
+	res.certificates = len(r.certificateResults)
+	for name, err := range r.certificateResults {
+		switch {
+		case err == nil:
+			res.syncedCertificates++
+		case !errors.Is(err, errNotSyncedYet):
+			res.failedCertificates++
+			errs = append(errs, fmt.Errorf("certificate %s: %w", name, err))
+		}
+	}
+
+	for _, err := range errs {
+		res.errs = append(res.errs, err.Error())
+	}
+	slices.Sort(res.errs)
+	if len(res.errs) > maxStatusErrors {
+		res.errs = res.errs[:maxStatusErrors]
+	}
+	return res
+}
+
+// outputPath maps a file of the repository containing the configuration
+// to the file the certificate is written to and creates its folder.
+func (r *repository) outputPath(file string) (string, error) {
+	outFile := file
+	if r.outputSyncer != nil {
+		relFile, err := filepath.Rel(r.Git.AbsLocalPath, file)
+		if err != nil {
+			return "", err
+		}
+		outFile = filepath.Join(r.OutputGit.AbsLocalPath, r.OutputGit.PathPrefix, relFile)
+		if !util.IsWithin(r.OutputGit.AbsLocalPath, outFile) {
+			return "", fmt.Errorf("output file %s is outside of the output repository", outFile)
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(outFile), 0755); err != nil {
+		return "", fmt.Errorf("failed to create folder %s: %w", filepath.Dir(outFile), err)
+	}
+	return outFile, nil
+}
+
+// commitMessage returns the message used when committing the certificate, which replaces the previous one.
+func (r *repository) commitMessage(cert *certificate.Certificate, certByte, previousCertByte []byte, isRestored bool) (string, error) {
+	data, err := certificate.NewCommitMessageData(certByte, previousCertByte)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse certificate: %w", err)
+	}
+	if isRestored {
+		data.Change = certificate.ChangeRestored
+	}
+	data.IssuerName = r.DefaultIssuer.Name
+	if configFile, err := filepath.Rel(r.Git.AbsLocalPath, cert.ConfigFile); err == nil {
+		data.ConfigFile = filepath.ToSlash(configFile)
+	}
+	return certificate.RenderCommitMessage(r.commitMessageTpl, data)
+}
+
+// vaultClients returns the primary Vault, if configured, followed by the Vaults certificates are replicated to.
+func (r *repository) vaultClients() []*vault.Client {
+	if r.vaultClient == nil {
+		return r.vaultTargets
+	}
+	return append([]*vault.Client{r.vaultClient}, r.vaultTargets...)
+}
+
+// encodedOutput returns the last encoding of the output of the certificate.
+func (r *repository) encodedOutput(name, format string) ([]byte, bool) {
+	r.encodedOutputsMtx.Lock()
+	defer r.encodedOutputsMtx.Unlock()
+	content, ok := r.encodedOutputs[name+"/"+format]
+	return content, ok
+}
+
+func (r *repository) setEncodedOutput(name, format string, content []byte) {
+	r.encodedOutputsMtx.Lock()
+	defer r.encodedOutputsMtx.Unlock()
+	r.encodedOutputs[name+"/"+format] = content
+}
+
+// chainOutputs returns the configured outputs of the normalized chain by name. Unavailable outputs are omitted.
+func (r *repository) chainOutputs(chain certificate.Chain) map[string][]byte {
+	if len(r.ChainOutputs) == 0 {
+		return nil
+	}
+
+	outputs := make(map[string][]byte, len(r.ChainOutputs))
+	for _, name := range r.ChainOutputs {
+		if content := chain.Output(name); len(content) > 0 {
+			outputs[name] = content
+		}
+	}
+	return outputs
+}
+
+// isModifiedOutside returns whether the certificate and key files in the given state were modified
+// outside of git-cert-shim. Must be called while holding the lock of the repository.
+func (r *repository) isModifiedOutside(state certificate.FileState, files ...string) (bool, error) {
+	switch state {
+	case certificate.FilesModified:
+		return true, nil
+	case certificate.FilesOutdated:
+		// Expected before a renewal, unless someone else committed the outdated certificate.
+		return r.outputRepositorySyncer().IsChangedByOthers(files...)
+	default:
+		return false, nil
+	}
+}
+
+func (r *repository) outputRepositorySyncer() *git.RepositorySyncer {
+	if r.outputSyncer != nil {
+		return r.outputSyncer
+	}
+	return r.syncer
+}
@@ -17,8 +17,42 @@ import (
 type Certificate struct {
 	CommonName string   `yaml:"cn" json:"cn"`
 	SANS       []string `yaml:"sans,omitempty" json:"sans,omitempty"`
-	OutFolder  string   `yaml:"-" json:"-"`
-	VaultPath  string   `yaml:"-" json:"-"`
+	// Owners of the certificate, e.g. teams. Only used in templates.
+	Owners []string `yaml:"owners,omitempty" json:"owners,omitempty"`
+	// Vault configures how the certificate is written to Vault.
+	Vault *VaultSettings `yaml:"vault,omitempty" json:"vault,omitempty"`
+	// Outputs are additional formats the certificate is written in.
+	Outputs []Output `yaml:"outputs,omitempty" json:"outputs,omitempty"`
+	// PublicOnly writes the private key only to Vault and a pointer to it to Git.
+	PublicOnly bool `yaml:"publicOnly,omitempty" json:"publicOnly,omitempty"`
+	// Paths override the output paths configured for the file.
+	Paths *OutputPaths `yaml:"output,omitempty" json:"output,omitempty"`
+	// OutFolder is the folder the files are written to. Files are written to the paths below.
+	OutFolder string `yaml:"-" json:"-"`
+	CertFile  string `yaml:"-" json:"-"`
+	KeyFile   string `yaml:"-" json:"-"`
+	// KeyPointerFile is written instead of the KeyFile in public-only mode.
+	KeyPointerFile string            `yaml:"-" json:"-"`
+	ChainFiles     map[string]string `yaml:"-" json:"-"`
+	// Encryption of the files as configured for the folder.
+	Encryption Encryption `yaml:"-" json:"-"`
+	// VaultPath is the first of the VaultPaths, e.g. referenced by the key pointer file.
+	VaultPath string `yaml:"-" json:"-"`
+	// VaultPaths are all paths the certificate is written to in Vault.
+	VaultPaths []string `yaml:"-" json:"-"`
+	// VaultNamespace is the Vault Enterprise namespace the certificate is written to. Empty for the one of the controller.
+	VaultNamespace string `yaml:"-" json:"-"`
+	// VaultMetadata are the templates of the custom metadata configured for the file and the certificate.
+	VaultMetadata map[string]string `yaml:"-" json:"-"`
+	Repository    string            `yaml:"-" json:"-"`
+	ConfigFile    string            `yaml:"-" json:"-"`
+}
+
+// VaultSettings configure how a certificate is written to Vault.
+type VaultSettings struct {
+	// Metadata are templates of custom metadata. They override the ones of the file and the controller.
+	// An empty template removes the respective key.
+	Metadata map[string]string `yaml:"metadata,omitempty" json:"metadata,omitempty"`
 }
 
 func (c *Certificate) GetName() string {
@@ -36,11 +70,21 @@ func ReadCertificateConfig(filePath string) ([]*Certificate, error) {
 	if err != nil {
 		return nil, err
 	}
+	return ParseCertificateConfig(filePath, fileByte)
+}
 
+// ParseCertificateConfig parses the certificate configuration read from the given file.
+func ParseCertificateConfig(filePath string, fileByte []byte) ([]*Certificate, error) {
 	type certCfg struct {
 		Vault struct {
+			Namespace    string `yaml:"namespace"`
 			PathTemplate string `yaml:"path"`
+			// PathTemplates are additional paths the certificate is written to.
+			PathTemplates []string          `yaml:"paths"`
+			Metadata      map[string]string `yaml:"metadata"`
 		} `yaml:"vault"`
+		Output       OutputPaths    `yaml:"output"`
+		Encryption   Encryption     `yaml:"encryption"`
 		Certificates []*Certificate `yaml:"certificates" json:"certificates"`
 	}
 
@@ -49,28 +93,74 @@ func ReadCertificateConfig(filePath string) ([]*Certificate, error) {
 		return nil, err
 	}
 
-	vaultPathTpl, err := template.New(filePath + "/vault.path").Parse(c.Vault.PathTemplate)
-	if err != nil {
+	pathTemplates := c.Vault.PathTemplates
+	if c.Vault.PathTemplate != "" || len(pathTemplates) == 0 {
+		pathTemplates = append([]string{c.Vault.PathTemplate}, pathTemplates...)
+	}
+	vaultPathTpls := make([]*template.Template, len(pathTemplates))
+	for i, text := range pathTemplates {
+		tpl, err := template.New(filePath + "/vault.path").Parse(text)
+		if err != nil {
+			return nil, err
+		}
+		vaultPathTpls[i] = tpl
+	}
+
+	if err := c.Encryption.Validate(); err != nil {
+		return nil, err
+	}
+	if err := ValidateMetadataTemplates(c.Vault.Metadata); err != nil {
 		return nil, err
 	}
 
+	filePaths := c.Output.merge(DefaultOutputPaths)
+	encryption := c.Encryption
+	fileMetadata := c.Vault.Metadata
+	vaultNamespace := c.Vault.Namespace
 	certs := c.Certificates
 	for idx, c := range certs {
 		// Ensure the common name is part of the SANs.
 		certs[idx].SANS = checkSANs(c.CommonName, c.SANS)
 
+		for _, o := range c.Outputs {
+			if err := o.Validate(); err != nil {
+				return nil, fmt.Errorf("certificate %q: %w", c.CommonName, err)
+			}
+		}
+
 		// Remember where to store the certificate and key in Git.
-		certs[idx].OutFolder = filepath.Dir(filePath)
+		paths := filePaths
+		if c.Paths != nil {
+			paths = c.Paths.merge(filePaths)
+		}
+		if err := paths.resolve(c, filepath.Dir(filePath)); err != nil {
+			return nil, fmt.Errorf("certificate %q: %w", c.CommonName, err)
+		}
+		certs[idx].ConfigFile = filePath
+		certs[idx].Encryption = encryption
 
 		// Calculate where to store the certificate and key in Vault.
-		var buf bytes.Buffer
-		err = vaultPathTpl.Execute(&buf, map[string]any{
-			"PathSafeCommonName": strings.ReplaceAll(c.CommonName, "*", "wildcard"),
-		})
-		if err != nil {
-			return nil, fmt.Errorf("while evaluating vault.path template for %q: %w", c.CommonName, err)
+		certs[idx].VaultPaths = make([]string, len(vaultPathTpls))
+		for i, tpl := range vaultPathTpls {
+			var buf bytes.Buffer
+			err := tpl.Execute(&buf, map[string]any{
+				"PathSafeCommonName": pathSafeCommonName(c.CommonName),
+			})
+			if err != nil {
+				return nil, fmt.Errorf("while evaluating vault.path template for %q: %w", c.CommonName, err)
+			}
+			certs[idx].VaultPaths[i] = buf.String()
+		}
+		certs[idx].VaultPath = certs[idx].VaultPaths[0]
+		certs[idx].VaultNamespace = vaultNamespace
+
+		certs[idx].VaultMetadata = fileMetadata
+		if c.Vault != nil && len(c.Vault.Metadata) > 0 {
+			if err := ValidateMetadataTemplates(c.Vault.Metadata); err != nil {
+				return nil, fmt.Errorf("certificate %q: %w", c.CommonName, err)
+			}
+			certs[idx].VaultMetadata = MergeMetadataTemplates(fileMetadata, c.Vault.Metadata)
 		}
-		certs[idx].VaultPath = buf.String()
 	}
 
 	return certs, nil
@@ -0,0 +1,53 @@
+// SPDX-FileCopyrightText: 2020 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+// Package certtest creates certificates for tests.
+package certtest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// NewCertificate returns a PEM encoded certificate valid for an hour, see NewCertificateAndKey.
+func NewCertificate(t testing.TB, issuer string, serial int64, commonName string, sans ...string) []byte {
+	t.Helper()
+	cert, _ := NewCertificateAndKey(t, issuer, serial, commonName, sans...)
+	return cert
+}
+
+// NewCertificateAndKey returns a PEM encoded certificate valid for an hour and its key.
+// The certificate is signed by its own key, but names the given issuer.
+func NewCertificateAndKey(t testing.TB, issuer string, serial int64, commonName string, sans ...string) (certByte, keyByte []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: commonName},
+		Issuer:       pkix.Name{CommonName: issuer},
+		DNSNames:     append([]string{commonName}, sans...),
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	parent := &x509.Certificate{Subject: pkix.Name{CommonName: issuer}}
+	der, err := x509.CreateCertificate(rand.Reader, tpl, parent, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+}
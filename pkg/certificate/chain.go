@@ -0,0 +1,126 @@
+// SPDX-FileCopyrightText: 2020 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package certificate
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+const (
+	// OutputCA is the root CA.
+	OutputCA = "ca"
+	// OutputChain are the intermediate CAs.
+	OutputChain = "chain"
+	// OutputFullChain is the certificate followed by the intermediate CAs.
+	OutputFullChain = "fullchain"
+)
+
+// ChainOutputs are all outputs of the chain in the order they are written.
+var ChainOutputs = []string{OutputCA, OutputChain, OutputFullChain}
+
+// ValidateChainOutputs checks whether all given outputs are known.
+func ValidateChainOutputs(outputs []string) error {
+	for _, o := range outputs {
+		if !slices.Contains(ChainOutputs, o) {
+			return fmt.Errorf("unknown chain output %q. must be one of %s", o, strings.Join(ChainOutputs, ", "))
+		}
+	}
+	return nil
+}
+
+// Chain is the normalized chain of an issued certificate. All fields are PEM encoded and empty if not available.
+type Chain struct {
+	// CA is the root CA.
+	CA []byte
+	// Intermediates are the intermediate CAs starting with the issuer of the certificate.
+	Intermediates []byte
+	// FullChain is the certificate followed by the intermediates and, if requested, the root CA.
+	FullChain []byte
+}
+
+// NewChain orders the certificates of the chain starting with the leaf up to the root CA.
+// Certificates not part of the chain are dropped.
+func NewChain(caByte, certByte []byte, includeRoot bool) (Chain, error) {
+	certs, err := parseCertificates(certByte)
+	if err != nil {
+		return Chain{}, err
+	}
+	var cas []*x509.Certificate
+	if len(bytes.TrimSpace(caByte)) > 0 {
+		if cas, err = parseCertificates(caByte); err != nil {
+			return Chain{}, fmt.Errorf("invalid CA: %w", err)
+		}
+	}
+
+	leaf := certs[0]
+	var (
+		intermediates []*x509.Certificate
+		root          *x509.Certificate
+		candidates    = append(slices.Clone(certs[1:]), cas...)
+	)
+	// Each candidate can be part of the chain only once.
+	for cur := leaf; len(intermediates) < len(candidates); {
+		issuer := findIssuer(cur, candidates)
+		if issuer == nil || issuer.Equal(cur) {
+			break
+		}
+		if bytes.Equal(issuer.RawSubject, issuer.RawIssuer) {
+			root = issuer
+			break
+		}
+		intermediates = append(intermediates, issuer)
+		cur = issuer
+	}
+
+	var chain Chain
+	switch {
+	case len(cas) > 0:
+		chain.CA = encodeCertificates(cas...)
+	case root != nil:
+		chain.CA = encodeCertificates(root)
+	}
+	chain.Intermediates = encodeCertificates(intermediates...)
+	chain.FullChain = encodeCertificates(append([]*x509.Certificate{leaf}, intermediates...)...)
+	if includeRoot && root != nil {
+		chain.FullChain = append(chain.FullChain, encodeCertificates(root)...)
+	}
+	return chain, nil
+}
+
+// Output returns the content of the given output.
+func (c Chain) Output(output string) []byte {
+	switch output {
+	case OutputCA:
+		return c.CA
+	case OutputChain:
+		return c.Intermediates
+	case OutputFullChain:
+		return c.FullChain
+	default:
+		return nil
+	}
+}
+
+// findIssuer returns the candidate that signed the certificate or nil.
+func findIssuer(cert *x509.Certificate, candidates []*x509.Certificate) *x509.Certificate {
+	for _, c := range candidates {
+		if bytes.Equal(c.RawSubject, cert.RawIssuer) && cert.CheckSignatureFrom(c) == nil {
+			return c
+		}
+	}
+	return nil
+}
+
+func encodeCertificates(certs ...*x509.Certificate) []byte {
+	var buf bytes.Buffer
+	for _, c := range certs {
+		pem.Encode(&buf, &pem.Block{Type: "CERTIFICATE", Bytes: c.Raw}) //nolint:errcheck
+	}
+	return buf.Bytes()
+}
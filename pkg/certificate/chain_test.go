@@ -0,0 +1,104 @@
+// SPDX-FileCopyrightText: 2020 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package certificate
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func TestNewChain(t *testing.T) {
+	root, rootKey := newTestCA(t, "Root CA")
+	intermediate, intermediateKey := newTestIntermediateCA(t, root, rootKey, "Intermediate CA")
+	leafByte, _ := newTestSignedCertificate(t, intermediate, intermediateKey, time.Now().Add(time.Hour), "a.tld")
+	rootByte := encodeCertificates(root)
+	intermediateByte := encodeCertificates(intermediate)
+	unrelated, _ := newTestCA(t, "Unrelated CA")
+
+	// Misordered with unrelated certificates.
+	certByte := concat(leafByte, encodeCertificates(unrelated), rootByte, intermediateByte)
+
+	tests := []struct {
+		name          string
+		ca            []byte
+		includeRoot   bool
+		expectedCA    []byte
+		expectedChain []byte
+		expectedFull  []byte
+	}{
+		{"with CA", rootByte, false, rootByte, intermediateByte, concat(leafByte, intermediateByte)},
+		{"with root", rootByte, true, rootByte, intermediateByte, concat(leafByte, intermediateByte, rootByte)},
+		{"root from certificate", nil, false, rootByte, intermediateByte, concat(leafByte, intermediateByte)},
+	}
+	for _, tt := range tests {
+		chain, err := NewChain(tt.ca, certByte, tt.includeRoot)
+		if err != nil {
+			t.Fatalf("%s: %s", tt.name, err.Error())
+		}
+		if !bytes.Equal(chain.Output(OutputCA), tt.expectedCA) {
+			t.Errorf("%s: unexpected CA:\n%s", tt.name, chain.CA)
+		}
+		if !bytes.Equal(chain.Output(OutputChain), tt.expectedChain) {
+			t.Errorf("%s: unexpected intermediates:\n%s", tt.name, chain.Intermediates)
+		}
+		if !bytes.Equal(chain.Output(OutputFullChain), tt.expectedFull) {
+			t.Errorf("%s: unexpected full chain:\n%s", tt.name, chain.FullChain)
+		}
+	}
+
+	// Issued directly by a CA not included in the secret.
+	chain, err := NewChain(nil, leafByte, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chain.CA) != 0 || len(chain.Intermediates) != 0 || !bytes.Equal(chain.FullChain, leafByte) {
+		t.Errorf("expected only the leaf, got %+v", chain)
+	}
+}
+
+func TestValidateChainOutputs(t *testing.T) {
+	if err := ValidateChainOutputs([]string{OutputCA, OutputChain, OutputFullChain}); err != nil {
+		t.Error(err)
+	}
+	if err := ValidateChainOutputs([]string{"bundle"}); err == nil {
+		t.Error("expected error for unknown output")
+	}
+}
+
+func newTestIntermediateCA(t *testing.T, parent *x509.Certificate, parentKey *ecdsa.PrivateKey, commonName string) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(3),
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tpl, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+func concat(parts ...[]byte) []byte {
+	return bytes.Join(parts, nil)
+}
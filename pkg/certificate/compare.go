@@ -0,0 +1,131 @@
+// SPDX-FileCopyrightText: 2020 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package certificate
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+)
+
+// FileState describes the certificate and key files in the repository compared to the ones issued.
+type FileState int
+
+const (
+	// FilesMissing means neither the certificate nor the key file exist.
+	FilesMissing FileState = iota
+	// FilesUnchanged means the files are identical to the issued certificate and key.
+	FilesUnchanged
+	// FilesOutdated means the files contain a different, consistent certificate and key, e.g. before a renewal.
+	FilesOutdated
+	// FilesModified means the files contain the issued certificate and key in altered form,
+	// only one of the files exists, or the files are invalid or do not match each other.
+	FilesModified
+)
+
+func (s FileState) String() string {
+	switch s {
+	case FilesMissing:
+		return "missing"
+	case FilesUnchanged:
+		return "unchanged"
+	case FilesOutdated:
+		return "outdated"
+	case FilesModified:
+		return "modified"
+	default:
+		return fmt.Sprintf("FileState(%d)", int(s))
+	}
+}
+
+// CompareFiles compares the content of the certificate and key files with the issued certificate and key.
+// The content of missing files is nil.
+func CompareFiles(fileCertByte, fileKeyByte, certByte, keyByte []byte) FileState {
+	switch {
+	case fileCertByte == nil && fileKeyByte == nil:
+		return FilesMissing
+	case bytes.Equal(fileCertByte, certByte) && bytes.Equal(fileKeyByte, keyByte):
+		return FilesUnchanged
+	}
+
+	fileCert, err := ParseLeafCertificate(fileCertByte)
+	if err != nil {
+		return FilesModified
+	}
+	fileKey, err := ParsePrivateKey(fileKeyByte)
+	if err != nil || !isPublicKeyOf(fileKey, fileCert.PublicKey) {
+		return FilesModified
+	}
+
+	// The same certificate should be byte-for-byte identical.
+	cert, err := ParseLeafCertificate(certByte)
+	if err == nil && cert.SerialNumber.Cmp(fileCert.SerialNumber) == 0 && isPublicKeyOf(fileKey, cert.PublicKey) {
+		return FilesModified
+	}
+	return FilesOutdated
+}
+
+// CompareCertificateFile compares the content of the certificate file with the issued certificate. Used if the key
+// is not written to the repository. The content of a missing file is nil.
+func CompareCertificateFile(fileCertByte, certByte []byte) FileState {
+	switch {
+	case fileCertByte == nil:
+		return FilesMissing
+	case bytes.Equal(fileCertByte, certByte):
+		return FilesUnchanged
+	}
+
+	fileCert, err := ParseLeafCertificate(fileCertByte)
+	if err != nil {
+		return FilesModified
+	}
+	cert, err := ParseLeafCertificate(certByte)
+	if err == nil && cert.SerialNumber.Cmp(fileCert.SerialNumber) == 0 {
+		return FilesModified
+	}
+	return FilesOutdated
+}
+
+// ParsePrivateKey parses the first PEM encoded private key in PKCS#8, PKCS#1 or SEC 1 format.
+func ParsePrivateKey(keyByte []byte) (crypto.Signer, error) {
+	for {
+		var block *pem.Block
+		block, keyByte = pem.Decode(keyByte)
+		if block == nil {
+			return nil, errors.New("no private key found")
+		}
+
+		var (
+			key any
+			err error
+		)
+		switch block.Type {
+		case "PRIVATE KEY":
+			key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+		case "RSA PRIVATE KEY":
+			key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+		case "EC PRIVATE KEY":
+			key, err = x509.ParseECPrivateKey(block.Bytes)
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("unsupported private key type %T", key)
+		}
+		return signer, nil
+	}
+}
+
+func isPublicKeyOf(key crypto.Signer, publicKey crypto.PublicKey) bool {
+	pub, ok := key.Public().(interface{ Equal(crypto.PublicKey) bool })
+	return ok && pub.Equal(publicKey)
+}
@@ -0,0 +1,60 @@
+// SPDX-FileCopyrightText: 2020 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package certificate
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/sapcc/git-cert-shim/pkg/certificate/certtest"
+)
+
+func TestCompareFiles(t *testing.T) {
+	oldCert, oldKey := certtest.NewCertificateAndKey(t, "Issuer A", 1, "a.tld")
+	cert, key := certtest.NewCertificateAndKey(t, "Issuer A", 2, "a.tld")
+	_, otherKey := certtest.NewCertificateAndKey(t, "Issuer A", 3, "a.tld")
+
+	tests := []struct {
+		name     string
+		fileCert []byte
+		fileKey  []byte
+		expected FileState
+	}{
+		{"missing", nil, nil, FilesMissing},
+		{"unchanged", cert, key, FilesUnchanged},
+		{"outdated", oldCert, oldKey, FilesOutdated},
+		{"reformatted", append(bytes.Clone(cert), '\n'), key, FilesModified},
+		{"key missing", oldCert, nil, FilesModified},
+		{"certificate missing", nil, oldKey, FilesModified},
+		{"key not matching", oldCert, otherKey, FilesModified},
+		{"invalid certificate", []byte("garbage"), oldKey, FilesModified},
+	}
+	for _, tt := range tests {
+		if state := CompareFiles(tt.fileCert, tt.fileKey, cert, key); state != tt.expected {
+			t.Errorf("%s: expected state %s, got %s", tt.name, tt.expected.String(), state.String())
+		}
+	}
+}
+
+func TestCompareCertificateFile(t *testing.T) {
+	oldCert, _ := certtest.NewCertificateAndKey(t, "Issuer A", 1, "a.tld")
+	cert, _ := certtest.NewCertificateAndKey(t, "Issuer A", 2, "a.tld")
+
+	tests := []struct {
+		name     string
+		fileCert []byte
+		expected FileState
+	}{
+		{"missing", nil, FilesMissing},
+		{"unchanged", cert, FilesUnchanged},
+		{"outdated", oldCert, FilesOutdated},
+		{"reformatted", append(bytes.Clone(cert), '\n'), FilesModified},
+		{"invalid certificate", []byte("garbage"), FilesModified},
+	}
+	for _, tt := range tests {
+		if state := CompareCertificateFile(tt.fileCert, cert); state != tt.expected {
+			t.Errorf("%s: expected state %s, got %s", tt.name, tt.expected.String(), state.String())
+		}
+	}
+}
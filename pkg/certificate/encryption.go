@@ -0,0 +1,55 @@
+// SPDX-FileCopyrightText: 2020 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package certificate
+
+import (
+	"fmt"
+
+	"github.com/sapcc/git-cert-shim/pkg/sops"
+)
+
+const (
+	// EncryptKeys encrypts all files containing a private key.
+	EncryptKeys = "keys"
+	// EncryptAll encrypts all files written for a certificate.
+	EncryptAll = "all"
+)
+
+// Encryption configures encrypting the files of certificates in Git for age recipients in the format of SOPS.
+type Encryption struct {
+	// Scope is empty, i.e. no encryption, EncryptKeys or EncryptAll.
+	Scope string `yaml:"scope,omitempty" json:"scope,omitempty"`
+	// AgeRecipients are the public keys files are encrypted for, e.g. age1...
+	AgeRecipients []string `yaml:"ageRecipients,omitempty" json:"ageRecipients,omitempty"`
+}
+
+// Validate checks the scope and recipients.
+func (e Encryption) Validate() error {
+	switch e.Scope {
+	case "", EncryptKeys, EncryptAll:
+	default:
+		return fmt.Errorf("unknown encryption scope %q. must be one of %s, %s", e.Scope, EncryptKeys, EncryptAll)
+	}
+	if _, err := sops.ParseRecipients(e.AgeRecipients); err != nil {
+		return fmt.Errorf("invalid age recipient: %w", err)
+	}
+	return nil
+}
+
+// Merge returns the encryption given the one configured globally. The stricter scope applies.
+// The recipients take precedence over the global ones, if given.
+func (e Encryption) Merge(global Encryption) Encryption {
+	if e.Scope == "" || global.Scope == EncryptAll {
+		e.Scope = global.Scope
+	}
+	if len(e.AgeRecipients) == 0 {
+		e.AgeRecipients = global.AgeRecipients
+	}
+	return e
+}
+
+// IsEncrypted returns whether a file is encrypted, given whether it contains a private key.
+func (e Encryption) IsEncrypted(containsKey bool) bool {
+	return e.Scope == EncryptAll || e.Scope == EncryptKeys && containsKey
+}
@@ -0,0 +1,57 @@
+// SPDX-FileCopyrightText: 2020 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package certificate
+
+import (
+	"slices"
+	"testing"
+)
+
+const testAgeRecipient = "age1ql3z7hjy54pw3hyww5ayyfg7zqgvc7w3j2elw8zmrj2kg5sfn9aqmcac8p"
+
+func TestEncryptionMerge(t *testing.T) {
+	global := Encryption{Scope: EncryptKeys, AgeRecipients: []string{"global"}}
+	tests := []struct {
+		name               string
+		folder             Encryption
+		global             Encryption
+		expectedScope      string
+		expectedRecipients []string
+	}{
+		{"global", Encryption{}, global, EncryptKeys, []string{"global"}},
+		{"stricter folder", Encryption{Scope: EncryptAll}, global, EncryptAll, []string{"global"}},
+		{"stricter global", Encryption{Scope: EncryptKeys}, Encryption{Scope: EncryptAll}, EncryptAll, nil},
+		{"folder recipients", Encryption{AgeRecipients: []string{"folder"}}, global, EncryptKeys, []string{"folder"}},
+		{"folder only", Encryption{Scope: EncryptKeys, AgeRecipients: []string{"folder"}}, Encryption{}, EncryptKeys, []string{"folder"}},
+		{"none", Encryption{}, Encryption{}, "", nil},
+	}
+	for _, tt := range tests {
+		e := tt.folder.Merge(tt.global)
+		if e.Scope != tt.expectedScope || !slices.Equal(e.AgeRecipients, tt.expectedRecipients) {
+			t.Errorf("%s: unexpected encryption %+v", tt.name, e)
+		}
+	}
+
+	keys := Encryption{Scope: EncryptKeys}
+	if !keys.IsEncrypted(true) || keys.IsEncrypted(false) || !(Encryption{Scope: EncryptAll}).IsEncrypted(false) || (Encryption{}).IsEncrypted(true) {
+		t.Error("unexpected result of IsEncrypted")
+	}
+}
+
+func TestParseCertificateConfigEncryption(t *testing.T) {
+	cfg := "encryption:\n  scope: keys\n  ageRecipients:\n    - " + testAgeRecipient + "\ncertificates:\n  - cn: a.tld\n"
+	certs, err := ParseCertificateConfig("/repo/git-cert-shim.yaml", []byte(cfg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if certs[0].Encryption.Scope != EncryptKeys || !slices.Equal(certs[0].Encryption.AgeRecipients, []string{testAgeRecipient}) {
+		t.Errorf("unexpected encryption %+v", certs[0].Encryption)
+	}
+
+	for _, invalid := range []string{"encryption:\n  scope: some\n", "encryption:\n  ageRecipients: [age1invalid]\n"} {
+		if _, err := ParseCertificateConfig("/repo/git-cert-shim.yaml", []byte(invalid+"certificates:\n  - cn: a.tld\n")); err == nil {
+			t.Errorf("expected error for %q", invalid)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+// SPDX-FileCopyrightText: 2020 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package certificate
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+const (
+	// FormatPKCS12 is a password protected PKCS#12 archive containing the key and chain.
+	FormatPKCS12 = "pkcs12"
+	// FormatJKS is a password protected Java keystore containing the key and chain.
+	FormatJKS = "jks"
+	// FormatDER is the DER encoded certificate.
+	FormatDER = "der"
+	// FormatCombinedPEM is the PEM encoded chain followed by the key.
+	FormatCombinedPEM = "combined-pem"
+)
+
+// Formats are all supported output formats.
+var Formats = []string{FormatPKCS12, FormatJKS, FormatDER, FormatCombinedPEM}
+
+// Output is an additional format the certificate is written in.
+type Output struct {
+	Format string `yaml:"format" json:"format"`
+	// Password protects the output. Required for pkcs12 and jks.
+	Password *PasswordSource `yaml:"password,omitempty" json:"password,omitempty"`
+}
+
+// PasswordSource references a password either in a Kubernetes secret in the namespace of the repository or in Vault.
+type PasswordSource struct {
+	SecretName string `yaml:"secretName,omitempty" json:"secretName,omitempty"`
+	SecretKey  string `yaml:"secretKey,omitempty" json:"secretKey,omitempty"`
+	VaultPath  string `yaml:"vaultPath,omitempty" json:"vaultPath,omitempty"`
+	VaultKey   string `yaml:"vaultKey,omitempty" json:"vaultKey,omitempty"`
+}
+
+// Validate checks the format and whether a password is given if, and only if, the format requires one.
+func (o Output) Validate() error {
+	if !slices.Contains(Formats, o.Format) {
+		return fmt.Errorf("unknown output format %q. must be one of %s", o.Format, strings.Join(Formats, ", "))
+	}
+	if !o.NeedsPassword() {
+		if o.Password != nil {
+			return fmt.Errorf("output format %s does not support a password", o.Format)
+		}
+		return nil
+	}
+
+	p := o.Password
+	switch {
+	case p == nil:
+		return fmt.Errorf("output format %s requires a password", o.Format)
+	case p.SecretName != "" && p.VaultPath != "":
+		return fmt.Errorf("password of output format %s must be either read from a secret or from Vault", o.Format)
+	case p.SecretName != "" && p.SecretKey == "":
+		return fmt.Errorf("password of output format %s requires a secretKey", o.Format)
+	case p.VaultPath != "" && p.VaultKey == "":
+		return fmt.Errorf("password of output format %s requires a vaultKey", o.Format)
+	case p.SecretName == "" && p.VaultPath == "":
+		return fmt.Errorf("password of output format %s requires a secretName or vaultPath", o.Format)
+	}
+	return nil
+}
+
+// NeedsPassword returns whether the format is password protected.
+func (o Output) NeedsPassword() bool {
+	return o.Format == FormatPKCS12 || o.Format == FormatJKS
+}
+
+// ContainsKey returns whether the output contains the private key.
+func (o Output) ContainsKey() bool {
+	return o.Format != FormatDER
+}
+
+// IsBinary returns whether the output is not PEM encoded.
+func (o Output) IsBinary() bool {
+	return o.Format != FormatCombinedPEM
+}
+
+// FileName returns the name of the file the output is written to in Git.
+func (o Output) FileName(commonName string) string {
+	switch o.Format {
+	case FormatPKCS12:
+		return commonName + ".p12"
+	case FormatJKS:
+		return commonName + ".jks"
+	case FormatDER:
+		return commonName + ".der"
+	default:
+		return commonName + "-combined.pem"
+	}
+}
+
+// Encode returns the PEM encoded certificate chain and key in the format of the output.
+// The alias names the entry in JKS outputs. PKCS#12 and JKS outputs are encrypted using random salts, so use
+// IsEncoding to check whether existing content holds the same certificate and key.
+func (o Output) Encode(alias string, certByte, keyByte []byte, password string) ([]byte, error) {
+	chain, err := parseCertificates(certByte)
+	if err != nil {
+		return nil, err
+	}
+
+	switch o.Format {
+	case FormatDER:
+		return chain[0].Raw, nil
+	case FormatCombinedPEM:
+		return append(encodeCertificates(chain...), keyByte...), nil
+	}
+
+	if password == "" {
+		return nil, fmt.Errorf("output format %s requires a non-empty password", o.Format)
+	}
+	key, err := ParsePrivateKey(keyByte)
+	if err != nil {
+		return nil, fmt.Errorf("invalid private key: %w", err)
+	}
+
+	switch o.Format {
+	case FormatPKCS12:
+		return encodePKCS12(chain, key, password)
+	case FormatJKS:
+		return encodeJKS(alias, chain, key, password, chain[0].NotBefore)
+	default:
+		return nil, errors.New("unknown output format " + o.Format)
+	}
+}
+
+// IsEncoding returns whether the content is the PEM encoded certificate chain and key in the format of the output,
+// as returned by Encode. PKCS#12 and JKS outputs are decoded and compared by key and certificates.
+func (o Output) IsEncoding(content []byte, alias string, certByte, keyByte []byte, password string) bool {
+	if !o.NeedsPassword() {
+		expected, err := o.Encode(alias, certByte, keyByte, password)
+		return err == nil && bytes.Equal(content, expected)
+	}
+
+	chain, err := parseCertificates(certByte)
+	if err != nil {
+		return false
+	}
+	key, err := ParsePrivateKey(keyByte)
+	if err != nil {
+		return false
+	}
+	var (
+		decodedKey   crypto.PrivateKey
+		decodedChain []*x509.Certificate
+	)
+	switch o.Format {
+	case FormatPKCS12:
+		decodedKey, decodedChain, err = decodePKCS12(content, password)
+	case FormatJKS:
+		decodedKey, decodedChain, err = decodeJKS(content, alias, password)
+	default:
+		return false
+	}
+	if err != nil {
+		return false
+	}
+	k, ok := key.(interface{ Equal(crypto.PrivateKey) bool })
+	return ok && k.Equal(decodedKey) && slices.EqualFunc(chain, decodedChain, (*x509.Certificate).Equal)
+}
@@ -0,0 +1,225 @@
+// SPDX-FileCopyrightText: 2020 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package certificate
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pavlo-v-chernykh/keystore-go/v4"
+)
+
+func TestOutputValidate(t *testing.T) {
+	secret := &PasswordSource{SecretName: "keystore", SecretKey: "password"}
+	tests := []struct {
+		name        string
+		output      Output
+		expectedErr string
+	}{
+		{"der", Output{Format: FormatDER}, ""},
+		{"combined pem", Output{Format: FormatCombinedPEM}, ""},
+		{"pkcs12 from secret", Output{Format: FormatPKCS12, Password: secret}, ""},
+		{"jks from vault", Output{Format: FormatJKS, Password: &PasswordSource{VaultPath: "keystores/a", VaultKey: "password"}}, ""},
+		{"unknown format", Output{Format: "pfx"}, "unknown output format"},
+		{"password for der", Output{Format: FormatDER, Password: secret}, "does not support a password"},
+		{"missing password", Output{Format: FormatPKCS12}, "requires a password"},
+		{"missing key", Output{Format: FormatPKCS12, Password: &PasswordSource{SecretName: "keystore"}}, "requires a secretKey"},
+		{"both sources", Output{Format: FormatJKS, Password: &PasswordSource{SecretName: "a", SecretKey: "b", VaultPath: "c", VaultKey: "d"}}, "either"},
+		{"no source", Output{Format: FormatJKS, Password: &PasswordSource{}}, "requires a secretName or vaultPath"},
+	}
+	for _, tt := range tests {
+		err := tt.output.Validate()
+		switch {
+		case tt.expectedErr == "" && err != nil:
+			t.Errorf("%s: expected no error, got: %s", tt.name, err.Error())
+		case tt.expectedErr != "" && (err == nil || !strings.Contains(err.Error(), tt.expectedErr)):
+			t.Errorf("%s: expected error containing %q, got: %v", tt.name, tt.expectedErr, err)
+		}
+	}
+}
+
+func TestParseCertificateConfigOutputs(t *testing.T) {
+	cfg := `
+certificates:
+  - cn: a.tld
+    outputs:
+      - format: der
+      - format: pkcs12
+        password:
+          secretName: keystore
+          secretKey: password
+`
+	certs, err := ParseCertificateConfig("certs/config.yaml", []byte(cfg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(certs[0].Outputs) != 2 || certs[0].Outputs[1].Password.SecretKey != "password" {
+		t.Errorf("unexpected outputs: %+v", certs[0].Outputs)
+	}
+
+	if _, err := ParseCertificateConfig("certs/config.yaml", []byte(strings.ReplaceAll(cfg, "der", "p7b"))); err == nil {
+		t.Error("expected error for unknown format")
+	}
+}
+
+func TestEncodeOutputs(t *testing.T) {
+	ca, caKey := newTestCA(t, "Root CA")
+	intermediate, intermediateKey := newTestIntermediateCA(t, ca, caKey, "Intermediate CA")
+	leafByte, keyByte := newTestSignedCertificate(t, intermediate, intermediateKey, time.Now().Add(time.Hour), "a.tld")
+	certByte := concat(leafByte, encodeCertificates(intermediate))
+	leafBlock, _ := pem.Decode(leafByte)
+
+	der, err := Output{Format: FormatDER}.Encode("a-tld", certByte, keyByte, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(der, leafBlock.Bytes) {
+		t.Error("expected DER of the leaf certificate")
+	}
+
+	combined, err := Output{Format: FormatCombinedPEM}.Encode("a-tld", certByte, keyByte, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(combined, concat(certByte, keyByte)) {
+		t.Errorf("expected chain followed by key, got:\n%s", combined)
+	}
+
+	otherLeafByte, otherKeyByte := newTestSignedCertificate(t, intermediate, intermediateKey, time.Now().Add(time.Hour), "a.tld")
+	otherCertByte := concat(otherLeafByte, encodeCertificates(intermediate))
+	for _, format := range []string{FormatPKCS12, FormatJKS} {
+		o := Output{Format: format}
+		first, err := o.Encode("a-tld", certByte, keyByte, "secret")
+		if err != nil {
+			t.Fatal(err)
+		}
+		second, err := o.Encode("a-tld", certByte, keyByte, "secret")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Equal(first, second) {
+			t.Errorf("%s: expected random salts", format)
+		}
+		if !o.IsEncoding(second, "a-tld", certByte, keyByte, "secret") {
+			t.Errorf("%s: expected encoding of the same certificate and key", format)
+		}
+		switch {
+		case o.IsEncoding(first, "a-tld", otherCertByte, otherKeyByte, "secret"):
+			t.Errorf("%s: expected no encoding of another certificate", format)
+		case o.IsEncoding(first, "a-tld", leafByte, keyByte, "secret"):
+			t.Errorf("%s: expected no encoding of another chain", format)
+		case o.IsEncoding(first, "a-tld", certByte, keyByte, "other"):
+			t.Errorf("%s: expected no encoding with another password", format)
+		}
+		if _, err := o.Encode("a-tld", certByte, keyByte, ""); err == nil {
+			t.Errorf("%s: expected error for empty password", format)
+		}
+	}
+
+	if !(Output{Format: FormatDER}).IsEncoding(der, "a-tld", certByte, keyByte, "") {
+		t.Error("expected DER to be the encoding of the certificate")
+	}
+}
+
+func TestEncodePKCS12(t *testing.T) {
+	if _, err := exec.LookPath("openssl"); err != nil {
+		t.Skip("openssl not available")
+	}
+
+	ca, caKey := newTestCA(t, "Root CA")
+	intermediate, intermediateKey := newTestIntermediateCA(t, ca, caKey, "Intermediate CA")
+	leafByte, keyByte := newTestSignedCertificate(t, intermediate, intermediateKey, time.Now().Add(time.Hour), "a.tld")
+	certByte := concat(leafByte, encodeCertificates(intermediate))
+
+	p12, err := Output{Format: FormatPKCS12}.Encode("a-tld", certByte, keyByte, "s3cr3t-ü")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fileName := filepath.Join(t.TempDir(), "a.tld.p12")
+	if err := os.WriteFile(fileName, p12, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := exec.Command("openssl", "pkcs12", "-in", fileName, "-passin", "pass:s3cr3t-ü", "-nodes").CombinedOutput()
+	if err != nil {
+		t.Fatalf("openssl failed to read PKCS#12: %s\n%s", err.Error(), out)
+	}
+	chain, err := parseCertificates(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chain) != 2 || !bytes.Equal(encodeCertificates(chain...), certByte) {
+		t.Errorf("unexpected certificates:\n%s", out)
+	}
+	if key, err := ParsePrivateKey(out); err != nil || !isPublicKeyOf(key, chain[0].PublicKey) {
+		t.Errorf("expected key of the certificate, got: %v", err)
+	}
+
+	out, err = exec.Command("openssl", "pkcs12", "-in", fileName, "-passin", "pass:wrong", "-nodes").CombinedOutput()
+	if err == nil {
+		t.Errorf("expected openssl to fail with wrong password:\n%s", out)
+	}
+}
+
+func TestEncodeJKS(t *testing.T) {
+	ca, caKey := newTestCA(t, "Root CA")
+	intermediate, intermediateKey := newTestIntermediateCA(t, ca, caKey, "Intermediate CA")
+	leafByte, keyByte := newTestSignedCertificate(t, intermediate, intermediateKey, time.Now().Add(time.Hour), "a.tld")
+	certByte := concat(leafByte, encodeCertificates(intermediate))
+	password := "s3cr3t"
+
+	jks, err := Output{Format: FormatJKS}.Encode("a-tld", certByte, keyByte, password)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ks := keystore.New()
+	if err := ks.Load(bytes.NewReader(jks), []byte(password)); err != nil {
+		t.Fatal(err)
+	}
+	if aliases := ks.Aliases(); len(aliases) != 1 || aliases[0] != "a-tld" {
+		t.Fatalf("unexpected aliases %v", aliases)
+	}
+	entry, err := ks.GetPrivateKeyEntry("a-tld", []byte(password))
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(entry.PrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var chain []*x509.Certificate
+	for _, c := range entry.CertificateChain {
+		if c.Type != "X.509" {
+			t.Fatalf("unexpected certificate type %q", c.Type)
+		}
+		cert, err := x509.ParseCertificate(c.Content)
+		if err != nil {
+			t.Fatal(err)
+		}
+		chain = append(chain, cert)
+	}
+	if !bytes.Equal(encodeCertificates(chain...), certByte) {
+		t.Error("unexpected certificate chain")
+	}
+	if !entry.CreationTime.Equal(chain[0].NotBefore) {
+		t.Errorf("expected creation date %s, got %s", chain[0].NotBefore, entry.CreationTime)
+	}
+	if !isPublicKeyOf(key.(crypto.Signer), chain[0].PublicKey) {
+		t.Error("key does not match certificate")
+	}
+
+	if err := keystore.New().Load(bytes.NewReader(jks), []byte("wrong")); err == nil {
+		t.Error("expected error for wrong password")
+	}
+}
@@ -0,0 +1,69 @@
+// SPDX-FileCopyrightText: 2020 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package certificate
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"errors"
+	"time"
+
+	"github.com/pavlo-v-chernykh/keystore-go/v4"
+)
+
+// jksCertificateType is the type of the certificates in a Java keystore.
+const jksCertificateType = "X.509"
+
+// encodeJKS encodes the key and chain, starting with the leaf, as Java keystore protected by the password.
+// The key uses the same password as the keystore. The creation date of the entry is the given time.
+func encodeJKS(alias string, chain []*x509.Certificate, key crypto.Signer, password string, created time.Time) ([]byte, error) {
+	pkcs8Key, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	entry := keystore.PrivateKeyEntry{CreationTime: created, PrivateKey: pkcs8Key}
+	for _, cert := range chain {
+		entry.CertificateChain = append(entry.CertificateChain, keystore.Certificate{Type: jksCertificateType, Content: cert.Raw})
+	}
+
+	ks := keystore.New()
+	if err := ks.SetPrivateKeyEntry(alias, entry, []byte(password)); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := ks.Store(&buf, []byte(password)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decodeJKS returns the key and chain, starting with the leaf, of the entry with the alias in a Java keystore
+// protected by the password.
+func decodeJKS(content []byte, alias, password string) (crypto.PrivateKey, []*x509.Certificate, error) {
+	ks := keystore.New()
+	if err := ks.Load(bytes.NewReader(content), []byte(password)); err != nil {
+		return nil, nil, err
+	}
+	entry, err := ks.GetPrivateKeyEntry(alias, []byte(password))
+	if err != nil {
+		return nil, nil, err
+	}
+	key, err := x509.ParsePKCS8PrivateKey(entry.PrivateKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	chain := make([]*x509.Certificate, 0, len(entry.CertificateChain))
+	for _, c := range entry.CertificateChain {
+		if c.Type != jksCertificateType {
+			return nil, nil, errors.New("unexpected certificate type " + c.Type)
+		}
+		cert, err := x509.ParseCertificate(c.Content)
+		if err != nil {
+			return nil, nil, err
+		}
+		chain = append(chain, cert)
+	}
+	return key, chain, nil
+}
@@ -0,0 +1,139 @@
+// SPDX-FileCopyrightText: 2020 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package certificate
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const (
+	// ChangeNew is a certificate written for the first time.
+	ChangeNew = "new"
+	// ChangeRenewed is a certificate replacing one for the same names from the same issuer.
+	ChangeRenewed = "renewed"
+	// ChangeReissued is a certificate replacing one for different names or from a different issuer.
+	ChangeReissued = "reissued"
+	// ChangeRestored is a certificate replacing one modified outside of git-cert-shim.
+	ChangeRestored = "restored"
+)
+
+// DefaultCommitMessageTemplate is the template of the message used when committing a certificate.
+const DefaultCommitMessageTemplate = `{{ if eq .Change "new" }}added{{ else }}{{ .Change }}{{ end }} certificate for {{ .CommonName }}`
+
+// CommitMessageData is passed to the commit message template.
+type CommitMessageData struct {
+	CommonName   string
+	SANs         []string
+	SerialNumber string
+	NotBefore    time.Time
+	NotAfter     time.Time
+	// Issuer is the distinguished name of the issuer of the certificate.
+	Issuer string
+	// IssuerName is the name of the cert-manager issuer.
+	IssuerName string
+	// Change is one of new, renewed, reissued or restored.
+	Change string
+	// ConfigFile is the path of the configuration file relative to the root of the repository.
+	ConfigFile string
+}
+
+// ParseCommitMessageTemplate parses a commit message template.
+// Besides the functions provided by text/template, join is available, e.g. {{ join .SANs ", " }}.
+func ParseCommitMessageTemplate(text string) (*template.Template, error) {
+	tpl, err := template.New("commit-message").
+		Funcs(template.FuncMap{"join": strings.Join}).
+		Option("missingkey=error").
+		Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid commit message template: %w", err)
+	}
+	return tpl, nil
+}
+
+// NewCommitMessageData describes the certificate written over the previous one, which is nil if there was none.
+func NewCommitMessageData(certByte, previousCertByte []byte) (CommitMessageData, error) {
+	cert, err := ParseLeafCertificate(certByte)
+	if err != nil {
+		return CommitMessageData{}, err
+	}
+
+	data := CommitMessageData{
+		CommonName:   cert.Subject.CommonName,
+		SANs:         cert.DNSNames,
+		SerialNumber: FormatSerialNumber(cert),
+		NotBefore:    cert.NotBefore,
+		NotAfter:     cert.NotAfter,
+		Issuer:       cert.Issuer.String(),
+		Change:       ChangeNew,
+	}
+
+	// An unreadable previous certificate is treated like none at all.
+	previous, err := ParseLeafCertificate(previousCertByte)
+	if err == nil {
+		data.Change = ChangeReissued
+		if previous.Subject.CommonName == cert.Subject.CommonName &&
+			previous.Issuer.String() == cert.Issuer.String() &&
+			isSameNames(previous.DNSNames, cert.DNSNames) {
+			data.Change = ChangeRenewed
+		}
+	}
+
+	return data, nil
+}
+
+// RenderCommitMessage executes the template with the given data.
+func RenderCommitMessage(tpl *template.Template, data CommitMessageData) (string, error) {
+	var buf bytes.Buffer
+	if err := tpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("while evaluating commit message template for %q: %w", data.CommonName, err)
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
+
+// ParseLeafCertificate parses the first certificate of the PEM encoded chain.
+func ParseLeafCertificate(certByte []byte) (*x509.Certificate, error) {
+	for {
+		var block *pem.Block
+		block, certByte = pem.Decode(certByte)
+		if block == nil {
+			return nil, errors.New("no certificate found")
+		}
+		if block.Type == "CERTIFICATE" {
+			return x509.ParseCertificate(block.Bytes)
+		}
+	}
+}
+
+// FormatSerialNumber formats the serial number as colon separated hex bytes like openssl does.
+func FormatSerialNumber(cert *x509.Certificate) string {
+	serial := cert.SerialNumber.Bytes()
+	hexBytes := make([]string, len(serial))
+	for i, b := range serial {
+		hexBytes[i] = fmt.Sprintf("%02x", b)
+	}
+	return strings.Join(hexBytes, ":")
+}
+
+// Fingerprint returns the SHA-256 fingerprint of the certificate as hex.
+func Fingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+func isSameNames(a, b []string) bool {
+	a, b = slices.Clone(a), slices.Clone(b)
+	slices.Sort(a)
+	slices.Sort(b)
+	return slices.Equal(a, b)
+}
@@ -0,0 +1,64 @@
+// SPDX-FileCopyrightText: 2020 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package certificate
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/sapcc/git-cert-shim/pkg/certificate/certtest"
+)
+
+func TestCommitMessage(t *testing.T) {
+	tpl, err := ParseCommitMessageTemplate(DefaultCommitMessageTemplate + `
+
+Certificate-Serial: {{ .SerialNumber }}
+Certificate-SANs: {{ join .SANs "," }}
+Certificate-Config: {{ .ConfigFile }}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first := certtest.NewCertificate(t, "Issuer A", 1, "a.tld", "b.a.tld")
+	tests := []struct {
+		name     string
+		cert     []byte
+		previous []byte
+		expected string
+	}{
+		{"new", first, nil, "added certificate for a.tld\n\nCertificate-Serial: 01\nCertificate-SANs: a.tld,b.a.tld\nCertificate-Config: team-a/git-cert-shim.yaml"},
+		{"renewed", certtest.NewCertificate(t, "Issuer A", 258, "a.tld", "b.a.tld"), first, "renewed certificate for a.tld\n\nCertificate-Serial: 01:02\nCertificate-SANs: a.tld,b.a.tld\nCertificate-Config: team-a/git-cert-shim.yaml"},
+		{"other issuer", certtest.NewCertificate(t, "Issuer B", 2, "a.tld", "b.a.tld"), first, "reissued certificate for a.tld"},
+		{"other names", certtest.NewCertificate(t, "Issuer A", 2, "a.tld"), first, "reissued certificate for a.tld"},
+		{"invalid previous", first, []byte("garbage"), "added certificate for a.tld"},
+	}
+	for _, tt := range tests {
+		data, err := NewCommitMessageData(tt.cert, tt.previous)
+		if err != nil {
+			t.Fatalf("%s: %s", tt.name, err.Error())
+		}
+		data.ConfigFile = "team-a/git-cert-shim.yaml"
+		msg, err := RenderCommitMessage(tpl, data)
+		if err != nil {
+			t.Fatalf("%s: %s", tt.name, err.Error())
+		}
+		if !strings.HasPrefix(msg, tt.expected) {
+			t.Errorf("%s: expected message starting with %q, got %q", tt.name, tt.expected, msg)
+		}
+	}
+}
+
+func TestCommitMessageTemplateInvalid(t *testing.T) {
+	if _, err := ParseCommitMessageTemplate("{{ .CommonName "); err == nil {
+		t.Error("expected error parsing invalid template")
+	}
+
+	tpl, err := ParseCommitMessageTemplate("{{ .Unknown }}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := RenderCommitMessage(tpl, CommitMessageData{}); err == nil {
+		t.Error("expected error rendering unknown field")
+	}
+}
@@ -0,0 +1,63 @@
+// SPDX-FileCopyrightText: 2020 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package certificate
+
+import (
+	"bytes"
+	"fmt"
+	"maps"
+	"strings"
+	"text/template"
+)
+
+// ParseMetadataTemplate parses the template of a custom metadata value in Vault.
+// Besides the functions provided by text/template, join is available, e.g. {{ join .Owners "," }}.
+func ParseMetadataTemplate(key, text string) (*template.Template, error) {
+	tpl, err := template.New(key).
+		Funcs(template.FuncMap{"join": strings.Join}).
+		Option("missingkey=error").
+		Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template of metadata %s: %w", key, err)
+	}
+	return tpl, nil
+}
+
+// ValidateMetadataTemplates checks whether the templates of custom metadata can be parsed.
+func ValidateMetadataTemplates(templates map[string]string) error {
+	for key, text := range templates {
+		if _, err := ParseMetadataTemplate(key, text); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MergeMetadataTemplates returns the templates with the ones of overrides taking precedence.
+func MergeMetadataTemplates(templates, overrides map[string]string) map[string]string {
+	res := make(map[string]string, len(templates)+len(overrides))
+	maps.Copy(res, templates)
+	maps.Copy(res, overrides)
+	return res
+}
+
+// RenderMetadata executes the templates with the given data. Keys with an empty template are omitted.
+func RenderMetadata(templates map[string]string, data any) (map[string]string, error) {
+	res := make(map[string]string, len(templates))
+	for key, text := range templates {
+		if text == "" {
+			continue
+		}
+		tpl, err := ParseMetadataTemplate(key, text)
+		if err != nil {
+			return nil, err
+		}
+		var buf bytes.Buffer
+		if err := tpl.Execute(&buf, data); err != nil {
+			return nil, fmt.Errorf("while evaluating template of metadata %s: %w", key, err)
+		}
+		res[key] = strings.TrimSpace(buf.String())
+	}
+	return res, nil
+}
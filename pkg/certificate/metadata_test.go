@@ -0,0 +1,55 @@
+// SPDX-FileCopyrightText: 2020 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package certificate
+
+import (
+	"maps"
+	"testing"
+)
+
+func TestParseCertificateConfigMetadata(t *testing.T) {
+	cfg := `
+vault:
+  path: "team/{{ .PathSafeCommonName }}"
+  metadata:
+    application_criticality: medium
+    team: a
+certificates:
+  - cn: a.tld
+  - cn: b.tld
+    owners: [team-b]
+    vault:
+      metadata:
+        application_criticality: high
+        owners: '{{ join .Owners "," }}'
+`
+	certs, err := ParseCertificateConfig("/repo/git-cert-shim.yaml", []byte(cfg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !maps.Equal(certs[0].VaultMetadata, map[string]string{"application_criticality": "medium", "team": "a"}) {
+		t.Errorf("unexpected metadata %v", certs[0].VaultMetadata)
+	}
+	expected := map[string]string{"application_criticality": "high", "team": "a", "owners": `{{ join .Owners "," }}`}
+	if !maps.Equal(certs[1].VaultMetadata, expected) {
+		t.Errorf("unexpected metadata %v", certs[1].VaultMetadata)
+	}
+
+	rendered, err := RenderMetadata(certs[1].VaultMetadata, struct{ Owners []string }{certs[1].Owners})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rendered["owners"] != "team-b" {
+		t.Errorf("unexpected metadata %v", rendered)
+	}
+
+	for _, invalid := range []string{
+		"vault:\n  metadata:\n    a: '{{ .A'\ncertificates:\n  - cn: a.tld\n",
+		"certificates:\n  - cn: a.tld\n    vault:\n      metadata:\n        a: '{{ unknown }}'\n",
+	} {
+		if _, err := ParseCertificateConfig("/repo/git-cert-shim.yaml", []byte(invalid)); err == nil {
+			t.Errorf("expected error for %q", invalid)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+// SPDX-FileCopyrightText: 2020 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package certificate
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/sapcc/git-cert-shim/pkg/util"
+)
+
+// DefaultOutputPaths are used for all settings not given in the configuration.
+var DefaultOutputPaths = OutputPaths{
+	Dir:            ".",
+	CertFile:       "{{ .PathSafeCommonName }}.pem",
+	KeyFile:        "{{ .PathSafeCommonName }}-key.pem",
+	ChainFile:      "{{ .PathSafeCommonName }}-{{ .Output }}.pem",
+	KeyPointerFile: "{{ .PathSafeCommonName }}-key.vault.yaml",
+}
+
+// OutputPaths configure where the files of a certificate are written. All settings are Go templates, see PathData.
+type OutputPaths struct {
+	// Dir is the folder relative to the folder containing the configuration.
+	Dir string `yaml:"dir,omitempty" json:"dir,omitempty"`
+	// CertFile, KeyFile, ChainFile and KeyPointerFile are relative to Dir.
+	CertFile  string `yaml:"certFile,omitempty" json:"certFile,omitempty"`
+	KeyFile   string `yaml:"keyFile,omitempty" json:"keyFile,omitempty"`
+	ChainFile string `yaml:"chainFile,omitempty" json:"chainFile,omitempty"`
+	// KeyPointerFile references the key in Vault instead of the key file in public-only mode.
+	KeyPointerFile string `yaml:"keyPointerFile,omitempty" json:"keyPointerFile,omitempty"`
+}
+
+// PathData is available in the templates of the output paths.
+type PathData struct {
+	// CommonName is the common name as configured, e.g. *.example.com.
+	CommonName string
+	// Name is the name of the certificate resource, e.g. wildcard-example-com.
+	Name string
+	// PathSafeCommonName is the common name with * replaced, e.g. wildcard.example.com.
+	PathSafeCommonName string
+	// Output is the chain output, e.g. fullchain. Only set for ChainFile.
+	Output string
+}
+
+// merge returns the paths with unset settings taken from the given defaults.
+func (p OutputPaths) merge(defaults OutputPaths) OutputPaths {
+	if p.Dir == "" {
+		p.Dir = defaults.Dir
+	}
+	if p.CertFile == "" {
+		p.CertFile = defaults.CertFile
+	}
+	if p.KeyFile == "" {
+		p.KeyFile = defaults.KeyFile
+	}
+	if p.ChainFile == "" {
+		p.ChainFile = defaults.ChainFile
+	}
+	if p.KeyPointerFile == "" {
+		p.KeyPointerFile = defaults.KeyPointerFile
+	}
+	return p
+}
+
+// resolve sets the output folder and file paths of the certificate configured in the given folder.
+func (p OutputPaths) resolve(cert *Certificate, folder string) error {
+	data := PathData{
+		CommonName:         cert.CommonName,
+		Name:               cert.GetName(),
+		PathSafeCommonName: pathSafeCommonName(cert.CommonName),
+	}
+
+	dir, err := renderPath("dir", p.Dir, data)
+	if err != nil {
+		return err
+	}
+	cert.OutFolder = filepath.Join(folder, dir)
+
+	if cert.CertFile, err = renderFilePath("certFile", p.CertFile, cert.OutFolder, data); err != nil {
+		return err
+	}
+	if cert.KeyFile, err = renderFilePath("keyFile", p.KeyFile, cert.OutFolder, data); err != nil {
+		return err
+	}
+	if cert.KeyPointerFile, err = renderFilePath("keyPointerFile", p.KeyPointerFile, cert.OutFolder, data); err != nil {
+		return err
+	}
+	cert.ChainFiles = make(map[string]string, len(ChainOutputs))
+	for _, o := range ChainOutputs {
+		data.Output = o
+		if cert.ChainFiles[o], err = renderFilePath("chainFile", p.ChainFile, cert.OutFolder, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func renderFilePath(name, tpl, dir string, data PathData) (string, error) {
+	file, err := renderPath(name, tpl, data)
+	if err != nil {
+		return "", err
+	}
+	if file == "." {
+		return "", fmt.Errorf("output %s %q is empty", name, tpl)
+	}
+	return filepath.Join(dir, file), nil
+}
+
+func renderPath(name, tpl string, data PathData) (string, error) {
+	t, err := template.New(name).Option("missingkey=error").Parse(tpl)
+	if err != nil {
+		return "", fmt.Errorf("invalid output %s: %w", name, err)
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("while evaluating output %s for %q: %w", name, data.CommonName, err)
+	}
+	path := filepath.FromSlash(strings.TrimSpace(buf.String()))
+	if filepath.IsAbs(path) {
+		return "", fmt.Errorf("output %s %q must be a relative path", name, path)
+	}
+	return filepath.Clean(path), nil
+}
+
+// CheckPaths checks whether the files of the certificate and the given chain outputs are within the root of the
+// repository and distinct.
+func (c *Certificate) CheckPaths(root string, chainOutputs []string) error {
+	files := []string{c.CertFile, c.KeyFile, c.KeyPointerFile}
+	for _, o := range chainOutputs {
+		files = append(files, c.ChainFiles[o])
+	}
+	for _, o := range c.Outputs {
+		files = append(files, c.OutputFile(o))
+	}
+
+	seen := make(map[string]bool, len(files))
+	for _, f := range files {
+		if !util.IsWithin(root, f) {
+			return fmt.Errorf("output file %s is outside of the repository", f)
+		}
+		rel, _ := filepath.Rel(root, f) //nolint:errcheck
+		if f == c.ConfigFile {
+			return errors.New("output file must not be the configuration " + rel)
+		}
+		if seen[f] {
+			return errors.New("output file used more than once " + rel)
+		}
+		seen[f] = true
+	}
+	return nil
+}
+
+// OutputFile returns the path of the file the given format is written to.
+func (c *Certificate) OutputFile(o Output) string {
+	return filepath.Join(c.OutFolder, o.FileName(pathSafeCommonName(c.CommonName)))
+}
+
+func pathSafeCommonName(commonName string) string {
+	return strings.ReplaceAll(commonName, "*", "wildcard")
+}
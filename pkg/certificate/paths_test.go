@@ -0,0 +1,128 @@
+// SPDX-FileCopyrightText: 2020 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package certificate
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestOutputPaths(t *testing.T) {
+	cfg := `
+output:
+  dir: certs
+  keyFile: "keys/{{ .Name }}.key"
+certificates:
+  - cn: a.tld
+  - cn: "*.b.tld"
+    output:
+      dir: "../shared/{{ .PathSafeCommonName }}"
+      certFile: tls.crt
+      chainFile: "{{ .Output }}.crt"
+`
+	certs, err := ParseCertificateConfig("/repo/team/git-cert-shim.yaml", []byte(cfg))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		cert          *Certificate
+		expectedCert  string
+		expectedKey   string
+		expectedChain string
+	}{
+		{certs[0], "/repo/team/certs/a.tld.pem", "/repo/team/certs/keys/a-tld.key", "/repo/team/certs/a.tld-fullchain.pem"},
+		{certs[1], "/repo/shared/wildcard.b.tld/tls.crt", "/repo/shared/wildcard.b.tld/keys/wildcard-b-tld.key", "/repo/shared/wildcard.b.tld/fullchain.crt"},
+	}
+	for _, tt := range tests {
+		if tt.cert.CertFile != tt.expectedCert || tt.cert.KeyFile != tt.expectedKey || tt.cert.ChainFiles[OutputFullChain] != tt.expectedChain {
+			t.Errorf("%s: unexpected paths %s, %s, %s", tt.cert.CommonName, tt.cert.CertFile, tt.cert.KeyFile, tt.cert.ChainFiles[OutputFullChain])
+		}
+		if err := tt.cert.CheckPaths("/repo", ChainOutputs); err != nil {
+			t.Errorf("%s: %s", tt.cert.CommonName, err.Error())
+		}
+	}
+
+	// Defaults as before.
+	certs, err = ParseCertificateConfig("/repo/team/git-cert-shim.yaml", []byte("certificates:\n  - cn: \"*.a.tld\"\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if certs[0].CertFile != "/repo/team/wildcard.a.tld.pem" || certs[0].KeyFile != "/repo/team/wildcard.a.tld-key.pem" {
+		t.Errorf("unexpected default paths %s, %s", certs[0].CertFile, certs[0].KeyFile)
+	}
+}
+
+func TestCheckPaths(t *testing.T) {
+	tests := []struct {
+		name         string
+		output       string
+		chainOutputs []string
+		expectedErr  string
+	}{
+		{"outside of repository", "dir: ../../other", nil, "outside of the repository"},
+		{"file outside of repository", "certFile: ../../../etc/cert.pem", nil, "outside of the repository"},
+		{"same file", "keyFile: a.tld.pem", nil, "more than once"},
+		{"chain without output", "chainFile: chain.pem", ChainOutputs, "more than once"},
+		{"chain without output not written", "chainFile: chain.pem", []string{OutputChain}, ""},
+		{"configuration", "certFile: git-cert-shim.yaml", nil, "must not be the configuration"},
+	}
+	for _, tt := range tests {
+		cfg := "certificates:\n  - cn: a.tld\n    output:\n      " + tt.output + "\n"
+		certs, err := ParseCertificateConfig("/repo/team/git-cert-shim.yaml", []byte(cfg))
+		if err != nil {
+			t.Fatalf("%s: %s", tt.name, err.Error())
+		}
+		err = certs[0].CheckPaths("/repo", tt.chainOutputs)
+		switch {
+		case tt.expectedErr == "" && err != nil:
+			t.Errorf("%s: expected no error, got: %s", tt.name, err.Error())
+		case tt.expectedErr != "" && (err == nil || !strings.Contains(err.Error(), tt.expectedErr)):
+			t.Errorf("%s: expected error containing %q, got: %v", tt.name, tt.expectedErr, err)
+		}
+	}
+
+	for _, output := range []string{"dir: /etc", "certFile: \"{{ .Unknown }}\"", "keyFile: \"{{\""} {
+		cfg := "certificates:\n  - cn: a.tld\n    output:\n      " + output + "\n"
+		if _, err := ParseCertificateConfig("/repo/team/git-cert-shim.yaml", []byte(cfg)); err == nil {
+			t.Errorf("expected error for %s", output)
+		}
+	}
+}
+
+func TestVaultPaths(t *testing.T) {
+	tests := []struct {
+		cfg      string
+		expected []string
+	}{
+		{"certificates:\n  - cn: a.tld\n", []string{""}},
+		{"vault:\n  path: team/{{ .PathSafeCommonName }}\ncertificates:\n  - cn: a.tld\n", []string{"team/a.tld"}},
+		{
+			"vault:\n  path: team/{{ .PathSafeCommonName }}\n  paths:\n    - shared/{{ .PathSafeCommonName }}\ncertificates:\n  - cn: a.tld\n",
+			[]string{"team/a.tld", "shared/a.tld"},
+		},
+		{
+			"vault:\n  paths:\n    - a/{{ .PathSafeCommonName }}\n    - b/{{ .PathSafeCommonName }}\ncertificates:\n  - cn: a.tld\n",
+			[]string{"a/a.tld", "b/a.tld"},
+		},
+	}
+	for _, tt := range tests {
+		certs, err := ParseCertificateConfig("/repo/git-cert-shim.yaml", []byte(tt.cfg))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(certs[0].VaultPaths, tt.expected) || certs[0].VaultPath != tt.expected[0] {
+			t.Errorf("expected %v, got %v (%q)", tt.expected, certs[0].VaultPaths, certs[0].VaultPath)
+		}
+	}
+
+	certs, err := ParseCertificateConfig("/repo/git-cert-shim.yaml", []byte("vault:\n  namespace: admin/team\ncertificates:\n  - cn: a.tld\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if certs[0].VaultNamespace != "admin/team" {
+		t.Errorf("unexpected namespace %q", certs[0].VaultNamespace)
+	}
+}
@@ -0,0 +1,26 @@
+// SPDX-FileCopyrightText: 2020 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package certificate
+
+import (
+	"crypto"
+	"crypto/x509"
+
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// encodePKCS12 encodes the key and chain, starting with the leaf, as PKCS#12 protected by the password.
+// The key is encrypted using PBES2 with AES-256-CBC and the integrity protected by HMAC-SHA256, using random salts.
+func encodePKCS12(chain []*x509.Certificate, key crypto.Signer, password string) ([]byte, error) {
+	return pkcs12.Modern.Encode(key, chain[0], chain[1:], password)
+}
+
+// decodePKCS12 returns the key and chain, starting with the leaf, of a PKCS#12 protected by the password.
+func decodePKCS12(content []byte, password string) (crypto.PrivateKey, []*x509.Certificate, error) {
+	key, leaf, caCerts, err := pkcs12.DecodeChain(content, password)
+	if err != nil {
+		return nil, nil, err
+	}
+	return key, append([]*x509.Certificate{leaf}, caCerts...), nil
+}
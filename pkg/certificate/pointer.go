@@ -0,0 +1,41 @@
+// SPDX-FileCopyrightText: 2020 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package certificate
+
+import (
+	"bytes"
+
+	"gopkg.in/yaml.v3"
+)
+
+const keyPointerHeader = "# The private key of this certificate is not stored in Git. It is only written to Vault.\n"
+
+// KeyPointer is written to Git instead of the private key in public-only mode.
+type KeyPointer struct {
+	Vault VaultLocation `yaml:"vault"`
+}
+
+// VaultLocation references a value in a KV engine of Vault.
+type VaultLocation struct {
+	// Namespace is the Vault Enterprise namespace of the engine, if any.
+	Namespace string `yaml:"namespace,omitempty"`
+	Engine    string `yaml:"engine"`
+	Path      string `yaml:"path"`
+	Key       string `yaml:"key"`
+}
+
+// Marshal returns the content of the pointer file.
+func (p KeyPointer) Marshal() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(keyPointerHeader)
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(p); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
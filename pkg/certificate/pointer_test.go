@@ -0,0 +1,36 @@
+// SPDX-FileCopyrightText: 2020 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package certificate
+
+import (
+	"testing"
+)
+
+func TestKeyPointer(t *testing.T) {
+	certs, err := ParseCertificateConfig("/repo/team/git-cert-shim.yaml", []byte("certificates:\n  - cn: \"*.a.tld\"\n    publicOnly: true\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !certs[0].PublicOnly || certs[0].KeyPointerFile != "/repo/team/wildcard.a.tld-key.vault.yaml" {
+		t.Errorf("unexpected certificate %+v", certs[0])
+	}
+
+	content, err := KeyPointer{Vault: VaultLocation{Engine: "secrets", Path: "team/wildcard.a.tld", Key: "private-key"}}.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := keyPointerHeader + "vault:\n  engine: secrets\n  path: team/wildcard.a.tld\n  key: private-key\n"
+	if string(content) != expected {
+		t.Errorf("unexpected content:\n%s", content)
+	}
+
+	content, err = KeyPointer{Vault: VaultLocation{Namespace: "admin/team", Engine: "secrets", Path: "a.tld", Key: "tls.key"}}.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = keyPointerHeader + "vault:\n  namespace: admin/team\n  engine: secrets\n  path: a.tld\n  key: tls.key\n"
+	if string(content) != expected {
+		t.Errorf("unexpected content:\n%s", content)
+	}
+}
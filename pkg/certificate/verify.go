@@ -0,0 +1,104 @@
+// SPDX-FileCopyrightText: 2020 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package certificate
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ErrVerificationFailed is returned if an issued certificate must not be published.
+var ErrVerificationFailed = errors.New("certificate verification failed")
+
+// Verify checks the issued certificate and key before they are published. The key must match the certificate,
+// the chain must validate against the CA, if given, the common name and SANs must equal the configuration
+// and the certificate must be valid for at least the given duration.
+func (c *Certificate) Verify(caByte, certByte, keyByte []byte, minValidity time.Duration, now time.Time) error {
+	chain, err := parseCertificates(certByte)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrVerificationFailed, err)
+	}
+	leaf := chain[0]
+
+	key, err := ParsePrivateKey(keyByte)
+	if err != nil {
+		return fmt.Errorf("%w: invalid private key: %w", ErrVerificationFailed, err)
+	}
+	if !isPublicKeyOf(key, leaf.PublicKey) {
+		return fmt.Errorf("%w: private key does not match the certificate", ErrVerificationFailed)
+	}
+
+	if len(caByte) > 0 {
+		roots := x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(caByte) {
+			return fmt.Errorf("%w: no certificate found in CA", ErrVerificationFailed)
+		}
+		intermediates := x509.NewCertPool()
+		for _, cert := range chain[1:] {
+			intermediates.AddCert(cert)
+		}
+		_, err := leaf.Verify(x509.VerifyOptions{
+			Roots:         roots,
+			Intermediates: intermediates,
+			CurrentTime:   now,
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+		})
+		if err != nil {
+			return fmt.Errorf("%w: chain does not validate against the CA: %w", ErrVerificationFailed, err)
+		}
+	}
+
+	if !strings.EqualFold(leaf.Subject.CommonName, c.CommonName) {
+		return fmt.Errorf("%w: common name %q does not match configured %q", ErrVerificationFailed, leaf.Subject.CommonName, c.CommonName)
+	}
+	if !isSameNames(toLower(leaf.DNSNames), toLower(c.SANS)) {
+		return fmt.Errorf("%w: SANs %s do not match configured %s",
+			ErrVerificationFailed, strings.Join(leaf.DNSNames, ", "), strings.Join(c.SANS, ", "))
+	}
+
+	if remaining := leaf.NotAfter.Sub(now); remaining <= 0 {
+		return fmt.Errorf("%w: certificate expired at %s", ErrVerificationFailed, leaf.NotAfter.Format(time.RFC3339))
+	} else if remaining < minValidity {
+		return fmt.Errorf("%w: certificate expires at %s, which is less than the minimum validity of %s",
+			ErrVerificationFailed, leaf.NotAfter.Format(time.RFC3339), minValidity.String())
+	}
+	return nil
+}
+
+// parseCertificates parses all PEM encoded certificates starting with the leaf.
+func parseCertificates(certByte []byte) ([]*x509.Certificate, error) {
+	var res []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, certByte = pem.Decode(certByte)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("invalid certificate: %w", err)
+		}
+		res = append(res, cert)
+	}
+	if len(res) == 0 {
+		return nil, errors.New("no certificate found")
+	}
+	return res, nil
+}
+
+func toLower(names []string) []string {
+	res := slices.Clone(names)
+	for i, n := range res {
+		res[i] = strings.ToLower(n)
+	}
+	return res
+}
@@ -0,0 +1,112 @@
+// SPDX-FileCopyrightText: 2020 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package certificate
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sapcc/git-cert-shim/pkg/certificate/certtest"
+)
+
+func TestVerify(t *testing.T) {
+	now := time.Now()
+	ca, caKey := newTestCA(t, "Root CA")
+	otherCA, _ := newTestCA(t, "Other CA")
+	certByte, keyByte := newTestSignedCertificate(t, ca, caKey, now.Add(48*time.Hour), "a.tld", "b.tld")
+	_, otherKeyByte := certtest.NewCertificateAndKey(t, "Issuer", 1, "a.tld")
+	caByte := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Raw})
+	otherCAByte := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: otherCA.Raw})
+
+	cert := &Certificate{CommonName: "a.tld", SANS: []string{"a.tld", "B.tld"}}
+	tests := []struct {
+		name        string
+		cert        *Certificate
+		ca          []byte
+		key         []byte
+		minValidity time.Duration
+		now         time.Time
+		expectedErr string
+	}{
+		{"valid", cert, caByte, keyByte, 24 * time.Hour, now, ""},
+		{"valid without CA", cert, nil, keyByte, 0, now, ""},
+		{"key not matching", cert, caByte, otherKeyByte, 0, now, "private key does not match"},
+		{"invalid key", cert, caByte, []byte("garbage"), 0, now, "invalid private key"},
+		{"other CA", cert, otherCAByte, keyByte, 0, now, "chain does not validate"},
+		{"other common name", &Certificate{CommonName: "b.tld", SANS: cert.SANS}, caByte, keyByte, 0, now, "common name"},
+		{"other SANs", &Certificate{CommonName: "a.tld", SANS: []string{"a.tld"}}, caByte, keyByte, 0, now, "SANs"},
+		{"below minimum validity", cert, nil, keyByte, 72 * time.Hour, now, "less than the minimum validity"},
+		{"expired", cert, nil, keyByte, 0, now.Add(72 * time.Hour), "expired"},
+	}
+	for _, tt := range tests {
+		err := tt.cert.Verify(tt.ca, certByte, tt.key, tt.minValidity, tt.now)
+		switch {
+		case tt.expectedErr == "" && err != nil:
+			t.Errorf("%s: expected no error, got: %s", tt.name, err.Error())
+		case tt.expectedErr != "" && (!errors.Is(err, ErrVerificationFailed) || !strings.Contains(err.Error(), tt.expectedErr)):
+			t.Errorf("%s: expected verification error containing %q, got: %v", tt.name, tt.expectedErr, err)
+		}
+	}
+}
+
+func newTestCA(t *testing.T, commonName string) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * 365 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tpl, tpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ca, key
+}
+
+// newTestSignedCertificate returns a PEM encoded certificate signed by the CA and its key.
+func newTestSignedCertificate(t *testing.T, ca *x509.Certificate, caKey *ecdsa.PrivateKey, notAfter time.Time, commonName string, sans ...string) (certByte, keyByte []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tpl := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: commonName},
+		DNSNames:     append([]string{commonName}, sans...),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tpl, ca, &key.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+}
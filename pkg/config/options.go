@@ -8,6 +8,8 @@ import (
 	"time"
 
 	cmmeta "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
+
+	"github.com/sapcc/git-cert-shim/pkg/certificate"
 )
 
 type ControllerOptions struct {
@@ -15,6 +17,22 @@ type ControllerOptions struct {
 	Namespace string
 	DefaultIssuer           cmmeta.IssuerReference
 	RenewCertificatesBefore time.Duration
+	// DomainPolicyFile optionally restricts the domains certificates may be requested for by folder.
+	DomainPolicyFile string
+	// MinCertificateValidity is the minimum remaining validity of certificates to be published.
+	MinCertificateValidity time.Duration
+	// ChainOutputs are the outputs of the certificate chain written in addition to the certificate and key.
+	ChainOutputs []string
+	// IncludeRootInChain adds the root CA to the full chain output. Only used if ChainOutputs are given.
+	IncludeRootInChain bool
+	// CommitMessageTemplate is the Go template of the message used when committing a certificate.
+	CommitMessageTemplate string
+	// Encryption configures encrypting files in Git. Folders can configure a stricter scope and other recipients.
+	Encryption certificate.Encryption
+	// PublicOnly writes only the certificate and chain to Git. The private key is written to Vault only.
+	PublicOnly bool
+	// AgeIdentityFile contains the age identities used to check whether encrypted files are up to date.
+	AgeIdentityFile string
 }
 
 func (co *ControllerOptions) Validate() error {
@@ -30,5 +48,20 @@ func (co *ControllerOptions) Validate() error {
 	if co.DefaultIssuer.Group == "" {
 		return errors.New("default-issuer-group missing")
 	}
+	if err := certificate.ValidateChainOutputs(co.ChainOutputs); err != nil {
+		return err
+	}
+	if _, err := certificate.ParseCommitMessageTemplate(co.CommitMessageTemplate); err != nil {
+		return err
+	}
+	if err := co.Encryption.Validate(); err != nil {
+		return err
+	}
+	if co.Encryption.Scope != "" && len(co.Encryption.AgeRecipients) == 0 {
+		return errors.New("encryption requires age recipients")
+	}
+	if co.Encryption.Scope == certificate.EncryptAll && co.AgeIdentityFile == "" {
+		return errors.New("encrypting all files requires an age identity file")
+	}
 	return nil
 }
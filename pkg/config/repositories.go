@@ -0,0 +1,219 @@
+// SPDX-FileCopyrightText: 2020 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/sapcc/git-cert-shim/pkg/git"
+	"github.com/sapcc/git-cert-shim/pkg/vault"
+)
+
+var (
+	repositoryNameRegex = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]*[a-z0-9])?$`)
+	envVarReplacer      = strings.NewReplacer("-", "_", ".", "_", "/", "_")
+)
+
+// RepositoryOptions configure a single repository containing certificate configuration.
+type RepositoryOptions struct {
+	// Name uniquely identifies the repository.
+	Name string
+
+	// ControllerOptions overwrite the options of the controller for this repository.
+	// Unset options are taken from the controller.
+	ControllerOptions
+
+	// Git configures the repository containing the certificate configuration.
+	Git *git.Options
+
+	// OutputGit optionally configures a separate repository or branch certificates are written to.
+	OutputGit *git.Options
+
+	// Vault optionally overwrites the Vault options of the controller for this repository.
+	Vault *vault.Options
+
+	// VaultDisabled denies the repository access to Vault.
+	VaultDisabled bool
+
+	// VaultNamespaceFixed rejects certificates written to another Vault namespace than the one of the controller.
+	VaultNamespaceFixed bool
+}
+
+type repositoryGitConfig struct {
+	RemoteURL      string `yaml:"remoteURL"`
+	Branch         string `yaml:"branch"`
+	TokenFile      string `yaml:"tokenFile"`
+	SSHPrivkeyFile string `yaml:"sshPrivkeyFile"`
+}
+
+type repositoriesConfig struct {
+	Repositories []struct {
+		Name                string        `yaml:"name"`
+		Namespace           string        `yaml:"namespace"`
+		DomainPolicyFile    string        `yaml:"domainPolicyFile"`
+		SyncPeriod          time.Duration `yaml:"syncPeriod"`
+		repositoryGitConfig `yaml:",inline"`
+		Output              *struct {
+			Path                string `yaml:"path"`
+			repositoryGitConfig `yaml:",inline"`
+		} `yaml:"output"`
+	} `yaml:"repositories"`
+}
+
+// ReadRepositoriesConfig reads the repositories to handle from the given file.
+// Git options not given in the file are taken from the given defaults.
+func ReadRepositoriesConfig(filePath string, defaults *git.Options) ([]*RepositoryOptions, error) {
+	fileByte, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	var cfg repositoriesConfig
+	if err := yaml.Unmarshal(fileByte, &cfg); err != nil {
+		return nil, err
+	}
+	if len(cfg.Repositories) == 0 {
+		return nil, fmt.Errorf("no repositories configured in %s", filePath)
+	}
+
+	seen := make(map[string]bool)
+	res := make([]*RepositoryOptions, 0, len(cfg.Repositories))
+	for _, r := range cfg.Repositories {
+		if !repositoryNameRegex.MatchString(r.Name) {
+			return nil, fmt.Errorf("invalid repository name %q: must consist of lower case alphanumeric characters or '-'", r.Name)
+		}
+		if seen[r.Name] {
+			return nil, fmt.Errorf("duplicate repository name %q", r.Name)
+		}
+		seen[r.Name] = true
+
+		gitOpts := NewRepositoryGitOptions(r.Name, defaults)
+		if r.SyncPeriod != 0 {
+			gitOpts.SyncPeriod = r.SyncPeriod
+		}
+		if err := r.apply(gitOpts); err != nil {
+			return nil, fmt.Errorf("repository %s: %w", r.Name, err)
+		}
+		// Fall back to the credentials given via flags or the environment variables without repository name.
+		if token, keyFile := gitOpts.Credentials(); token == "" && keyFile == "" {
+			gitOpts.GithubToken, gitOpts.GithubSSHPrivkeyFilename = defaults.Credentials()
+		}
+
+		opts := &RepositoryOptions{
+			Name:              r.Name,
+			ControllerOptions: ControllerOptions{Namespace: r.Namespace, DomainPolicyFile: r.DomainPolicyFile},
+			Git:               gitOpts,
+		}
+
+		if r.Output != nil {
+			opts.OutputGit = &git.Options{
+				EnvVarPrefix: gitOpts.EnvVarPrefix + "_OUTPUT",
+				PathPrefix:   r.Output.Path,
+			}
+			if err := r.Output.apply(opts.OutputGit); err != nil {
+				return nil, fmt.Errorf("output of repository %s: %w", r.Name, err)
+			}
+		}
+
+		res = append(res, opts)
+	}
+
+	return res, nil
+}
+
+// NewRepositoryGitOptions returns the Git options of the named repository.
+// Settings not specific to a repository are taken from the given defaults.
+func NewRepositoryGitOptions(name string, defaults *git.Options) *git.Options {
+	return &git.Options{
+		AbsLocalPath:           filepath.Join(os.TempDir(), "git-cert-shim", name),
+		BranchName:             defaults.BranchName,
+		AuthorName:             defaults.AuthorName,
+		AuthorEmail:            defaults.AuthorEmail,
+		SyncPeriod:             defaults.SyncPeriod,
+		IsEnsureEmptyDirectory: defaults.IsEnsureEmptyDirectory,
+		PushCertificates:       defaults.PushCertificates,
+		DryRun:                 defaults.DryRun,
+		SigningKeyFile:         defaults.SigningKeyFile,
+		SigningFormat:          defaults.SigningFormat,
+		TrustedSSHSignersFile:  defaults.TrustedSSHSignersFile,
+		TrustedGPGKeysFile:     defaults.TrustedGPGKeysFile,
+		CommitBatchWindow:      defaults.CommitBatchWindow,
+		CommitBatchSize:        defaults.CommitBatchSize,
+		EnvVarPrefix:           repositoryEnvVarPrefix(name),
+	}
+}
+
+// repositoryEnvVarPrefix returns the prefix of the environment variables options of the named repository are read from.
+func repositoryEnvVarPrefix(name string) string {
+	return "GIT_" + strings.ToUpper(envVarReplacer.Replace(name))
+}
+
+func (c *repositoryGitConfig) apply(opts *git.Options) error {
+	if c.RemoteURL != "" {
+		opts.RemoteURL = c.RemoteURL
+	}
+	if c.Branch != "" {
+		opts.BranchName = c.Branch
+	}
+	if c.TokenFile != "" && c.SSHPrivkeyFile != "" {
+		return errors.New("only one of tokenFile and sshPrivkeyFile may be given")
+	}
+	if c.TokenFile != "" {
+		token, err := os.ReadFile(c.TokenFile)
+		if err != nil {
+			return err
+		}
+		opts.GithubToken = strings.TrimSpace(string(token))
+	}
+	if c.SSHPrivkeyFile != "" {
+		opts.GithubSSHPrivkeyFilename = c.SSHPrivkeyFile
+	}
+	return nil
+}
+
+// SetDefaults sets all options that are not given to the ones of the given defaults.
+func (co *ControllerOptions) SetDefaults(defaults *ControllerOptions) {
+	if co.ConfigFileName == "" {
+		co.ConfigFileName = defaults.ConfigFileName
+	}
+	if co.Namespace == "" {
+		co.Namespace = defaults.Namespace
+	}
+	if co.DefaultIssuer.Name == "" {
+		co.DefaultIssuer = defaults.DefaultIssuer
+	}
+	if co.RenewCertificatesBefore == 0 {
+		co.RenewCertificatesBefore = defaults.RenewCertificatesBefore
+	}
+	if co.DomainPolicyFile == "" {
+		co.DomainPolicyFile = defaults.DomainPolicyFile
+	}
+	if co.MinCertificateValidity == 0 {
+		co.MinCertificateValidity = defaults.MinCertificateValidity
+	}
+	if co.ChainOutputs == nil {
+		co.ChainOutputs = defaults.ChainOutputs
+		co.IncludeRootInChain = defaults.IncludeRootInChain
+	}
+	if co.CommitMessageTemplate == "" {
+		co.CommitMessageTemplate = defaults.CommitMessageTemplate
+	}
+	if co.Encryption.Scope == "" && co.Encryption.AgeRecipients == nil {
+		co.Encryption = defaults.Encryption
+	}
+	if co.AgeIdentityFile == "" {
+		co.AgeIdentityFile = defaults.AgeIdentityFile
+	}
+	if !co.PublicOnly {
+		co.PublicOnly = defaults.PublicOnly
+	}
+}
@@ -19,6 +19,7 @@ var errCmdNotInstalled = errors.New("command not installed")
 type command struct {
 	cmd         string
 	defaultArgs []string
+	env         []string
 	timeout     time.Duration
 }
 
@@ -35,6 +36,9 @@ func newCommand(cmd string, defaultArgs ...string) (*command, error) {
 // Run starts the command, waits until it finished and returns stdOut or an error containing the stdError message.
 func (c *command) run(args ...string) (string, error) {
 	cmd := exec.Command(c.cmd, append(c.defaultArgs, args...)...) //nolint:gosec
+	if len(c.env) > 0 {
+		cmd.Env = append(os.Environ(), c.env...)
+	}
 
 	if v, ok := os.LookupEnv("DEBUG"); ok && v == "true" {
 		fmt.Println("running: ", cmd.String())
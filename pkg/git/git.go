@@ -16,12 +16,18 @@ import (
 type Git struct {
 	*Options
 	*command
+	signer   *signer
+	verifier *verifier
 }
 
 func NewGit(opts *Options) (*Git, error) {
 	if err := opts.validate(); err != nil {
 		return nil, err
 	}
+	return newGit(opts)
+}
+
+func newGit(opts *Options) (*Git, error) {
 	if !filepath.IsAbs(opts.AbsLocalPath) {
 		return nil, fmt.Errorf("requires an absolute path. cannot use: %s", opts.AbsLocalPath)
 	}
@@ -32,18 +38,42 @@ func NewGit(opts *Options) (*Git, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &Git{
+	// Only the default key is picked up by ssh without further ado.
+	if opts.GithubSSHPrivkeyFilename != "" && opts.GithubSSHPrivkeyFilename != sshPrivateKeyFilename {
+		cmd.env = append(cmd.env, fmt.Sprintf("GIT_SSH_COMMAND=ssh -i %s -o IdentitiesOnly=yes", opts.GithubSSHPrivkeyFilename))
+	}
+
+	g := &Git{
 		Options: opts,
 		command: cmd,
-	}, nil
+	}
+	if opts.SigningKeyFile != "" {
+		s, err := newSigner(opts.SigningKeyFile, opts.SigningFormat)
+		if err != nil {
+			return nil, err
+		}
+		g.signer = s
+		cmd.env = append(cmd.env, s.env...)
+	}
+	if opts.TrustedSSHSignersFile != "" || opts.TrustedGPGKeysFile != "" {
+		v, err := newVerifier(opts)
+		if err != nil {
+			return nil, err
+		}
+		g.verifier = v
+	}
+	return g, nil
 }
 
 func (g *Git) Clone() error {
-	if res, err := g.run("clone",
-		"--progress",
-		"--depth", "1", "--single-branch", "--branch", g.BranchName,
-		g.RemoteURL, g.AbsLocalPath,
-	); err != nil {
+	args := []string{"clone", "--progress"}
+	// Verifying signatures requires the history.
+	if g.verifier == nil {
+		args = append(args, "--depth", "1")
+	}
+	args = append(args, "--single-branch", "--branch", g.BranchName, g.RemoteURL, g.AbsLocalPath)
+
+	if res, err := g.run(args...); err != nil {
 		return errors.Wrapf(err, "git clone failed: %s", res)
 	}
 	return nil
@@ -57,6 +87,42 @@ func (g *Git) GetHEADCommitHash() (string, error) {
 	return strings.TrimSpace(res), nil
 }
 
+// GetLastCommit returns the hash and the email of the author of the last commit changing any of the files.
+// Empty if none of the files was committed yet.
+func (g *Git) GetLastCommit(files ...string) (hash, authorEmail string, err error) {
+	res, err := g.run(append([]string{"log", "-1", "--format=%H %ae", "--"}, files...)...)
+	if err != nil {
+		return "", "", errors.Wrap(err, "git log failed")
+	}
+	hash, authorEmail, _ = strings.Cut(strings.TrimSpace(res), " ")
+	return hash, strings.Trim(authorEmail, `"`), nil
+}
+
+// IsShallowBoundary returns whether the commit is the oldest one of a shallow clone. As its parents are missing,
+// it appears to change every file.
+func (g *Git) IsShallowBoundary(hash string) (bool, error) {
+	res, err := g.run("rev-parse", "--is-shallow-repository")
+	if err != nil {
+		return false, errors.Wrap(err, "git rev-parse --is-shallow-repository failed")
+	}
+	if strings.TrimSpace(res) != "true" {
+		return false, nil
+	}
+	parents, err := g.run("log", "-1", "--format=%P", hash)
+	if err != nil {
+		return false, errors.Wrap(err, "git log failed")
+	}
+	return strings.TrimSpace(parents) == "", nil
+}
+
+// Unshallow fetches the complete history of a shallow clone.
+func (g *Git) Unshallow() error {
+	if res, err := g.run("fetch", "--unshallow"); err != nil {
+		return errors.Wrapf(err, "git fetch --unshallow failed: %s", res)
+	}
+	return nil
+}
+
 func (g *Git) GetRemoteHEADCommitHash() (string, error) {
 	res, err := g.run("ls-remote", "--heads", "-q")
 	if err != nil {
@@ -68,12 +134,13 @@ func (g *Git) GetRemoteHEADCommitHash() (string, error) {
 // PullRebase pulls and rebases.
 func (g *Git) PullRebase() error {
 	_, _ = g.run("rebase", "--abort") //nolint:errcheck
-	_, err := g.run(
+	// Rebased commits are signed as well.
+	_, err := g.run(append(g.signingArgs(),
 		"-c", fmt.Sprintf(`user.name="%s"`, g.AuthorName),
 		"-c", fmt.Sprintf(`user.email="%s"`, g.AuthorEmail),
 		"pull",
 		"--rebase",
-	)
+	)...)
 	if err != nil {
 		return errors.Wrap(err, "git pull failed")
 	}
@@ -98,14 +165,15 @@ func (g *Git) Commit(commitMessage string) error {
 		return err
 	}
 
-	_, err := g.run(
+	_, err := g.run(append(g.signingArgs(),
 		"-c", fmt.Sprintf(`user.name="%s"`, g.AuthorName),
 		"-c", fmt.Sprintf(`user.email="%s"`, g.AuthorEmail),
 		"commit",
 		"--all",
 		"--author", fmt.Sprintf(`"%s <%s>"`, g.AuthorName, g.AuthorEmail),
-		"--message", fmt.Sprintf(`"%s"`, commitMessage),
-	)
+		// Passed as is, so trailers in the last paragraph are recognized.
+		"--message", commitMessage,
+	)...)
 	if err != nil {
 		return errors.Wrap(err, "git commit failed")
 	}
@@ -156,6 +224,14 @@ func (g *Git) getPushURL() (string, error) {
 	return remote, nil
 }
 
+// signingArgs returns the arguments configuring git to sign commits, if a signing key is configured.
+func (g *Git) signingArgs() []string {
+	if g.signer == nil {
+		return nil
+	}
+	return g.signer.configArgs()
+}
+
 func (g *Git) checkWriteAllowed() error {
 	// Write operations are only allowed with author name and email.
 	if g.AuthorEmail == "" || g.AuthorName == "" {
@@ -9,7 +9,7 @@ import (
 )
 
 func init() {
-	metrics.Registry.MustRegister(gitSyncErrorTotal)
+	metrics.Registry.MustRegister(gitSyncErrorTotal, gitUntrustedFiles)
 }
 
 const metricNamespace = "git_cert_shim"
@@ -22,4 +22,11 @@ var (
 		Help:        "Counter for git synchronization errors",
 		ConstLabels: nil,
 	}, []string{"operation"})
+
+	gitUntrustedFiles = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricNamespace,
+		Subsystem: "git",
+		Name:      "untrusted_files",
+		Help:      "Number of verified files whose most recent change is not signed by a trusted key",
+	}, []string{"remote_url", "branch"})
 )
@@ -14,9 +14,10 @@ import (
 )
 
 const (
-	gitRemoteURLEnvVarkey      = "GIT_REMOTE_URL"
-	gitTokenEnvVarKey          = "GIT_API_TOKEN" //nolint:gosec
-	gitSSHPrivkeyFileEnvVarKey = "GIT_SSH_PRIVKEY_FILE"
+	defaultEnvVarPrefix        = "GIT"
+	gitRemoteURLEnvVarKey      = "REMOTE_URL"
+	gitTokenEnvVarKey          = "API_TOKEN" //nolint:gosec
+	gitSSHPrivkeyFileEnvVarKey = "SSH_PRIVKEY_FILE"
 )
 
 var (
@@ -59,16 +60,123 @@ type Options struct {
 
 	// Do not push to remote repository (but still write to the local Git clone)
 	DryRun bool
+
+	// EnvVarPrefix is the prefix of the environment variables options are read from, if not given explicitly.
+	// Defaults to GIT, e.g. GIT_REMOTE_URL.
+	EnvVarPrefix string
+
+	// SigningKeyFile is the file containing the GPG or SSH private key used to sign commits.
+	// Commits are not signed if empty.
+	SigningKeyFile string
+
+	// SigningFormat is the format of the signing key. Either openpgp or ssh. Detected from the key if empty.
+	SigningFormat string
+
+	// TrustedSSHSignersFile is a file in the format of ssh-keygen's allowed signers file listing trusted SSH keys.
+	// If given, changes to files named VerifiedFileName are only accepted from commits signed by a trusted key.
+	TrustedSSHSignersFile string
+
+	// TrustedGPGKeysFile is a file containing trusted GPG public keys.
+	// If given, changes to files named VerifiedFileName are only accepted from commits signed by a trusted key.
+	TrustedGPGKeysFile string
+
+	// VerifiedFileName is the name of the files, whose changes are verified, if trusted keys are given.
+	VerifiedFileName string
+
+	// CommitBatchWindow is the duration files are collected for, before they are committed together.
+	// Batching is disabled if neither CommitBatchWindow nor CommitBatchSize are given.
+	CommitBatchWindow time.Duration
+
+	// CommitBatchSize is the number of changes after which collected files are committed together.
+	// Batching is disabled if neither CommitBatchWindow nor CommitBatchSize are given.
+	CommitBatchSize int
+
+	// PathPrefix is the directory, relative to the repository root, files are written to.
+	// Only allowed if certificates are written to a separate repository or branch.
+	PathPrefix string
+}
+
+// Inherit completes the options of a separate repository or branch, certificates are written to,
+// with the options of the repository containing the configuration.
+// The parent options must have been validated before.
+func (o *Options) Inherit(parent *Options) error {
+	if o.RemoteURL == "" {
+		o.RemoteURL = parent.RemoteURL
+		if v, ok := os.LookupEnv(o.envVarKey(gitRemoteURLEnvVarKey)); ok {
+			o.RemoteURL = v
+		}
+	}
+	if o.BranchName == "" {
+		o.BranchName = parent.BranchName
+	}
+	if o.AbsLocalPath == "" {
+		o.AbsLocalPath = parent.AbsLocalPath + "-output"
+	}
+
+	// Use the same credentials unless others are provided.
+	_, hasTokenEnv := os.LookupEnv(o.envVarKey(gitTokenEnvVarKey))
+	_, hasSSHPrivkeyEnv := os.LookupEnv(o.envVarKey(gitSSHPrivkeyFileEnvVarKey))
+	if o.GithubToken == "" && o.GithubSSHPrivkeyFilename == "" && !hasTokenEnv && !hasSSHPrivkeyEnv {
+		o.GithubToken = parent.GithubToken
+		o.GithubSSHPrivkeyFilename = parent.GithubSSHPrivkeyFilename
+	}
+
+	o.AuthorName = parent.AuthorName
+	o.AuthorEmail = parent.AuthorEmail
+	o.SyncPeriod = parent.SyncPeriod
+	o.IsEnsureEmptyDirectory = parent.IsEnsureEmptyDirectory
+	o.SigningKeyFile = parent.SigningKeyFile
+	o.SigningFormat = parent.SigningFormat
+	o.PushCertificates = parent.PushCertificates
+	o.DryRun = parent.DryRun
+	o.CommitBatchWindow = parent.CommitBatchWindow
+	o.CommitBatchSize = parent.CommitBatchSize
+
+	// Files are written next to their configuration, if it is the same branch.
+	if o.PathPrefix != "" && o.IsSameRepositoryAndBranch(parent) {
+		return errors.Errorf("output path %q requires a separate repository or branch", o.PathPrefix)
+	}
+	return o.validatePathPrefix()
+}
+
+// HasRemoteURL returns whether a remote URL was given either explicitly or via environment.
+func (o *Options) HasRemoteURL() bool {
+	if o.RemoteURL != "" {
+		return true
+	}
+	_, ok := os.LookupEnv(o.envVarKey(gitRemoteURLEnvVarKey))
+	return ok
+}
+
+// Credentials returns the token and the SSH private key file given either explicitly or via environment.
+// The environment takes precedence as done when validating the options.
+func (o *Options) Credentials() (token, sshPrivkeyFilename string) {
+	token, sshPrivkeyFilename = o.GithubToken, o.GithubSSHPrivkeyFilename
+	if v, ok := os.LookupEnv(o.envVarKey(gitTokenEnvVarKey)); ok {
+		token = v
+	}
+	if v, ok := os.LookupEnv(o.envVarKey(gitSSHPrivkeyFileEnvVarKey)); ok {
+		sshPrivkeyFilename = v
+	}
+	return token, sshPrivkeyFilename
+}
+
+// IsSameRepositoryAndBranch returns whether both options refer to the same branch of the same repository.
+func (o *Options) IsSameRepositoryAndBranch(other *Options) bool {
+	return o.RemoteURL == other.RemoteURL && o.BranchName == other.BranchName
 }
 
 func (o *Options) validate() error {
+	if err := o.validatePathPrefix(); err != nil {
+		return err
+	}
 	if err := o.validateAuth(); err != nil {
 		return err
 	}
 
 	// Validate remote URL.
 	if o.RemoteURL == "" {
-		v, ok := os.LookupEnv(gitRemoteURLEnvVarkey)
+		v, ok := os.LookupEnv(o.envVarKey(gitRemoteURLEnvVarKey))
 		if !ok {
 			return errGitNoRemote
 		}
@@ -95,32 +203,66 @@ func (o *Options) validate() error {
 	return nil
 }
 
+// validatePathPrefix ensures files are written within the repository.
+func (o *Options) validatePathPrefix() error {
+	if o.PathPrefix == "" {
+		return nil
+	}
+	if !filepath.IsLocal(o.PathPrefix) {
+		return errors.Errorf("output path %q must be a relative path within the repository", o.PathPrefix)
+	}
+	o.PathPrefix = filepath.Clean(o.PathPrefix)
+	return nil
+}
+
 func (o *Options) validateAuth() error {
 	// Attempt to read token from env if unset.
-	if ghToken, ok := os.LookupEnv(gitTokenEnvVarKey); ok {
+	if ghToken, ok := os.LookupEnv(o.envVarKey(gitTokenEnvVarKey)); ok {
 		o.GithubToken = ghToken
 	}
 	if o.GithubToken != "" {
-		fmt.Printf("Using %s from environment for authentication.\n", gitTokenEnvVarKey)
+		fmt.Printf("Using %s from environment for authentication.\n", o.envVarKey(gitTokenEnvVarKey))
 		return nil
 	}
 
-	// Attempt to read private key from given file and copy to default location.
-	if gitKeyFile, ok := os.LookupEnv(gitSSHPrivkeyFileEnvVarKey); ok {
-		fmt.Printf("Using %s from environment to load private key for authentication.\n", gitSSHPrivkeyFileEnvVarKey)
-		if err := checkFileExistsAndIsNotEmpty(gitKeyFile); err != nil {
+	// Attempt to read private key from given file and copy to the location used for this repository.
+	keyFile := o.GithubSSHPrivkeyFilename
+	if gitKeyFile, ok := os.LookupEnv(o.envVarKey(gitSSHPrivkeyFileEnvVarKey)); ok {
+		fmt.Printf("Using %s from environment to load private key for authentication.\n", o.envVarKey(gitSSHPrivkeyFileEnvVarKey))
+		keyFile = gitKeyFile
+	}
+	targetKeyFile := o.sshPrivkeyFilename()
+	if keyFile != "" && keyFile != targetKeyFile {
+		if err := checkFileExistsAndIsNotEmpty(keyFile); err != nil {
 			return err
 		}
-		if err := copyFile(gitKeyFile, sshPrivateKeyFilename); err != nil {
+		if err := copyFile(keyFile, targetKeyFile); err != nil {
 			return err
 		}
 	}
 
-	o.GithubSSHPrivkeyFilename = sshPrivateKeyFilename
-	err := checkFileExistsAndIsNotEmpty(sshPrivateKeyFilename)
+	o.GithubSSHPrivkeyFilename = targetKeyFile
+	err := checkFileExistsAndIsNotEmpty(targetKeyFile)
 	return err
 }
 
+func (o *Options) envVarKey(key string) string {
+	prefix := o.EnvVarPrefix
+	if prefix == "" {
+		prefix = defaultEnvVarPrefix
+	}
+	return prefix + "_" + key
+}
+
+// sshPrivkeyFilename returns the location of the SSH private key used for this repository.
+// Repositories not using the default environment variables get their own key file.
+func (o *Options) sshPrivkeyFilename() string {
+	if o.EnvVarPrefix == "" || o.EnvVarPrefix == defaultEnvVarPrefix {
+		return sshPrivateKeyFilename
+	}
+	return sshPrivateKeyFilename + "_" + strings.ToLower(o.EnvVarPrefix)
+}
+
 func checkFileExistsAndIsNotEmpty(filename string) error {
 	fileByte, err := os.ReadFile(filename)
 	if err != nil {
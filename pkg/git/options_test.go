@@ -0,0 +1,61 @@
+// SPDX-FileCopyrightText: 2020 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package git
+
+import (
+	"testing"
+)
+
+func TestInheritPathPrefix(t *testing.T) {
+	parent := &Options{RemoteURL: "git@github.com:org/repo.git", BranchName: "main", AbsLocalPath: "/tmp/repo"}
+
+	tests := []struct {
+		pathPrefix string
+		branch     string
+		expected   string
+		isValid    bool
+	}{
+		{"", "", "", true},
+		{"certs", "certificates", "certs", true},
+		{"certs/../team-a/", "certificates", "team-a", true},
+		{".", "certificates", ".", true},
+		{"/etc", "certificates", "", false},
+		{"..", "certificates", "", false},
+		{"certs/../../other", "certificates", "", false},
+		// Files are written next to their configuration in the same branch.
+		{"certs", "", "", false},
+		{"certs", "main", "", false},
+	}
+	for _, tt := range tests {
+		o := &Options{EnvVarPrefix: "GIT_TEST_OUTPUT", PathPrefix: tt.pathPrefix, BranchName: tt.branch}
+		err := o.Inherit(parent)
+		if tt.isValid != (err == nil) {
+			t.Errorf("%q on branch %q: expected valid %t, got %v", tt.pathPrefix, tt.branch, tt.isValid, err)
+			continue
+		}
+		if err == nil && o.PathPrefix != tt.expected {
+			t.Errorf("%q: expected %q, got %q", tt.pathPrefix, tt.expected, o.PathPrefix)
+		}
+	}
+
+	o := &Options{RemoteURL: parent.RemoteURL, PathPrefix: "../other"}
+	if err := o.validate(); err == nil {
+		t.Error("expected error validating output path outside of the repository")
+	}
+}
+
+func TestCredentials(t *testing.T) {
+	t.Setenv("GIT_TEST_API_TOKEN", "env-token")
+
+	o := &Options{EnvVarPrefix: "GIT_TEST", GithubToken: "flag-token", GithubSSHPrivkeyFilename: "/flag/id_rsa"}
+	token, keyFile := o.Credentials()
+	if token != "env-token" || keyFile != "/flag/id_rsa" {
+		t.Errorf("expected token from environment and key file from options, got %q and %q", token, keyFile)
+	}
+
+	o = &Options{EnvVarPrefix: "GIT_OTHER"}
+	if token, keyFile := o.Credentials(); token != "" || keyFile != "" {
+		t.Errorf("expected no credentials, got %q and %q", token, keyFile)
+	}
+}
@@ -6,6 +6,9 @@ package git
 import (
 	"context"
 	"fmt"
+	"regexp"
+	"slices"
+	"strings"
 	"sync"
 	"time"
 
@@ -15,6 +18,8 @@ import (
 
 const remoteName = "origin"
 
+var trailerRegex = regexp.MustCompile(`^[A-Za-z0-9-]+: `)
+
 type RepositorySyncer struct {
 	logger     logr.Logger
 	gitCli     *Git
@@ -23,6 +28,26 @@ type RepositorySyncer struct {
 	syncSoon   chan struct{}
 	hasSynced  bool
 	dryRun     bool
+
+	// batchWindow and batchSize configure collecting changes to commit them together. Disabled if both are zero.
+	batchWindow  time.Duration
+	batchSize    int
+	batchStarted chan struct{}
+	// batch holds the changes not committed yet. Guarded by mtx.
+	batch commitBatch
+
+	statusMtx        sync.Mutex
+	lastSyncedCommit string
+	lastSyncTime     time.Time
+	lastSyncErr      error
+	// trustedFiles are the verified files, if verification of commit signatures is configured.
+	trustedFiles map[string]TrustedFile
+}
+
+// commitBatch collects changes to be committed together.
+type commitBatch struct {
+	files    []string
+	messages []string
 }
 
 func NewRepositorySyncerAndInit(logger logr.Logger, opts *Options, mtx *sync.Mutex) (*RepositorySyncer, error) {
@@ -39,6 +64,10 @@ func NewRepositorySyncerAndInit(logger logr.Logger, opts *Options, mtx *sync.Mut
 		syncSoon:   make(chan struct{}, 1),
 		hasSynced:  false,
 		dryRun:     opts.DryRun,
+
+		batchWindow:  opts.CommitBatchWindow,
+		batchSize:    opts.CommitBatchSize,
+		batchStarted: make(chan struct{}, 1),
 	}
 
 	start := time.Now()
@@ -46,33 +75,50 @@ func NewRepositorySyncerAndInit(logger logr.Logger, opts *Options, mtx *sync.Mut
 	if err := r.clone(); err != nil {
 		return nil, err
 	}
+	if commit, err := git.GetHEADCommitHash(); err == nil {
+		r.lastSyncedCommit = commit
+		r.lastSyncTime = time.Now()
+	}
+	if err := r.verifyFiles(); err != nil {
+		return nil, err
+	}
 
 	logger.Info("successfully initialized repository syncer", "path", opts.AbsLocalPath, "took", time.Since(start).String())
 	return r, nil
 }
 
+// Start synchronizes the repository until the context is done. Returns once the last synchronization finished.
 func (r *RepositorySyncer) Start(ctx context.Context) error {
-	defer close(r.syncSoon)
+	ticker := time.NewTicker(r.syncPeriod)
+	defer ticker.Stop()
 
-	go func() {
-		ticker := time.NewTicker(r.syncPeriod)
-		defer ticker.Stop()
+	// batchTimer fires once the batch window elapsed after the first change was collected.
+	var batchTimer <-chan time.Time
 
-		for {
-			select {
-			case <-r.syncSoon:
-				err := r.syncWithRetry()
-				r.handleSyncError(err)
-			case <-ticker.C:
+	for {
+		select {
+		case <-r.syncSoon:
+			err := r.syncWithRetry()
+			r.handleSyncError(err)
+		case <-ticker.C:
+			err := r.syncWithRetry()
+			r.handleSyncError(err)
+		case <-r.batchStarted:
+			if batchTimer == nil {
+				batchTimer = time.After(r.batchWindow)
+			}
+		case <-batchTimer:
+			batchTimer = nil
+			r.flushBatch()
+		case <-ctx.Done():
+			// Do not lose collected changes.
+			if r.isBatching() {
 				err := r.syncWithRetry()
 				r.handleSyncError(err)
-			case <-ctx.Done():
-				return
 			}
+			return nil
 		}
-	}()
-	<-ctx.Done()
-	return nil
+	}
 }
 
 func (r *RepositorySyncer) AddFilesAndCommit(commitMessage string, files ...string) error {
@@ -85,6 +131,10 @@ func (r *RepositorySyncer) AddFilesAndCommit(commitMessage string, files ...stri
 		return nil
 	}
 
+	if r.isBatching() {
+		return r.addToBatch(commitMessage, files...)
+	}
+
 	if err := r.gitCli.Add(files...); err != nil {
 		return err
 	}
@@ -97,12 +147,216 @@ func (r *RepositorySyncer) AddFilesAndCommit(commitMessage string, files ...stri
 	return nil
 }
 
+// IsChangedByOthers returns whether the last commit changing any of the files was authored by someone else.
+// Must be called while holding the lock of the repository.
+func (r *RepositorySyncer) IsChangedByOthers(files ...string) (bool, error) {
+	hash, email, err := r.gitCli.GetLastCommit(files...)
+	if err != nil || hash == "" {
+		return false, err
+	}
+
+	// The oldest commit of a shallow clone appears to change every file, so the history is required.
+	isBoundary, err := r.gitCli.IsShallowBoundary(hash)
+	if err != nil {
+		return false, err
+	}
+	if isBoundary {
+		r.logger.Info("fetching the history of the shallow clone to find the last change of files", "files", files)
+		if err := r.gitCli.Unshallow(); err != nil {
+			return false, err
+		}
+		if _, email, err = r.gitCli.GetLastCommit(files...); err != nil {
+			return false, err
+		}
+	}
+	return email != "" && email != r.gitCli.AuthorEmail, nil
+}
+
+func (r *RepositorySyncer) isBatching() bool {
+	return r.batchWindow > 0 || r.batchSize > 0
+}
+
+// addToBatch collects the change to be committed together with others
+// once the batch window elapsed or the batch size is reached.
+// Must be called while holding the lock of the repository.
+func (r *RepositorySyncer) addToBatch(commitMessage string, files ...string) error {
+	isFirst := len(r.batch.messages) == 0
+	r.batch.files = append(r.batch.files, files...)
+	if !slices.Contains(r.batch.messages, commitMessage) {
+		r.batch.messages = append(r.batch.messages, commitMessage)
+	}
+
+	if r.batchSize > 0 && len(r.batch.messages) >= r.batchSize {
+		if err := r.commitBatch(); err != nil {
+			return err
+		}
+		r.requireSync()
+		return nil
+	}
+
+	if isFirst && r.batchWindow > 0 {
+		select {
+		case r.batchStarted <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// flushBatch commits the collected changes and triggers the synchronization.
+func (r *RepositorySyncer) flushBatch() {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	if err := r.commitBatch(); err != nil {
+		r.logger.Error(err, "failed to commit collected changes")
+		return
+	}
+	r.requireSync()
+}
+
+// commitBatch commits the collected changes with a message summarizing them.
+// Must be called while holding the lock of the repository.
+func (r *RepositorySyncer) commitBatch() error {
+	b := r.batch
+	if len(b.messages) == 0 {
+		return nil
+	}
+
+	// The changes are kept until committed, so a failed commit is retried.
+	res, err := r.gitCli.Status()
+	if err != nil {
+		return err
+	}
+	if res == "" {
+		r.logger.V(1).Info("No changes to commit.")
+		r.batch = commitBatch{}
+		return nil
+	}
+
+	slices.Sort(b.files)
+	if err := r.gitCli.Add(slices.Compact(b.files)...); err != nil {
+		gitSyncErrorTotal.WithLabelValues("commit").Inc()
+		return err
+	}
+	if err := r.gitCli.Commit(b.message()); err != nil {
+		gitSyncErrorTotal.WithLabelValues("commit").Inc()
+		return err
+	}
+	r.batch = commitBatch{}
+	r.logger.Info("committed collected changes", "changes", len(b.messages))
+	return nil
+}
+
+// message summarizes the collected changes. The subjects of all changes are listed
+// and their trailers are combined in the last paragraph.
+func (b *commitBatch) message() string {
+	if len(b.messages) == 1 {
+		return b.messages[0]
+	}
+
+	var subjects, trailers []string
+	for _, msg := range b.messages {
+		subject, t := splitCommitMessage(msg)
+		subjects = append(subjects, subject)
+		trailers = append(trailers, t...)
+	}
+
+	msg := fmt.Sprintf("%s and %d more\n\n- %s", subjects[0], len(subjects)-1, strings.Join(subjects, "\n- "))
+	if len(trailers) > 0 {
+		msg += "\n\n" + strings.Join(trailers, "\n")
+	}
+	return msg
+}
+
+// splitCommitMessage returns the first line and the trailers of the commit message.
+// Trailers are the lines of the last paragraph, if all of them are formatted like "Key: value".
+func splitCommitMessage(msg string) (subject string, trailers []string) {
+	paragraphs := strings.Split(strings.TrimSpace(msg), "\n\n")
+	subject, _, _ = strings.Cut(paragraphs[0], "\n")
+	if len(paragraphs) < 2 {
+		return subject, nil
+	}
+
+	lines := strings.Split(paragraphs[len(paragraphs)-1], "\n")
+	for _, line := range lines {
+		if !trailerRegex.MatchString(line) {
+			return subject, nil
+		}
+	}
+	return subject, lines
+}
+
+// TrustedFiles returns the verified files by absolute path and true,
+// if verification of commit signatures is configured. Otherwise, nil and false.
+func (r *RepositorySyncer) TrustedFiles() (map[string]TrustedFile, bool) {
+	if r.gitCli.verifier == nil {
+		return nil, false
+	}
+
+	r.statusMtx.Lock()
+	defer r.statusMtx.Unlock()
+	return r.trustedFiles, true
+}
+
+// verifyFiles determines the content of the verified files as of the last trusted change.
+// Must be called while holding the lock of the repository.
+func (r *RepositorySyncer) verifyFiles() error {
+	if r.gitCli.verifier == nil {
+		return nil
+	}
+
+	files, err := r.gitCli.TrustedFiles(r.gitCli.VerifiedFileName)
+	if err != nil {
+		gitSyncErrorTotal.WithLabelValues("verify").Inc()
+		return err
+	}
+
+	r.statusMtx.Lock()
+	defer r.statusMtx.Unlock()
+
+	untrusted := 0
+	for path, f := range files {
+		if f.UntrustedCommit == "" {
+			continue
+		}
+		untrusted++
+		// Only report new untrusted changes.
+		if prev, ok := r.trustedFiles[path]; !ok || prev.UntrustedCommit != f.UntrustedCommit {
+			r.logger.Info("ignoring changes not signed by a trusted key", "file", path, "commit", f.UntrustedCommit, "usingLastTrustedVersion", f.Content != nil)
+		}
+	}
+	gitUntrustedFiles.WithLabelValues(r.gitCli.RemoteURL, r.gitCli.BranchName).Set(float64(untrusted))
+
+	r.trustedFiles = files
+	return nil
+}
+
+// Status returns the commit the repository was last synchronized to, the time of the last successful
+// synchronization and the error of the last synchronization, if it failed.
+func (r *RepositorySyncer) Status() (commit string, syncTime time.Time, err error) {
+	r.statusMtx.Lock()
+	defer r.statusMtx.Unlock()
+	return r.lastSyncedCommit, r.lastSyncTime, r.lastSyncErr
+}
+
 func (r *RepositorySyncer) requireSync() {
 	r.hasSynced = false
-	r.syncSoon <- struct{}{}
+	// A pending synchronization covers this request as well.
+	select {
+	case r.syncSoon <- struct{}{}:
+	default:
+	}
 }
 
 func (r *RepositorySyncer) handleSyncError(err error) {
+	r.statusMtx.Lock()
+	r.lastSyncErr = err
+	if err == nil {
+		r.lastSyncTime = time.Now()
+	}
+	r.statusMtx.Unlock()
+
 	if err != nil {
 		fmt.Println("failed to sync", "err", err)
 		r.requireSync()
@@ -125,6 +379,11 @@ func (r *RepositorySyncer) syncWithRetry() error {
 	r.mtx.Lock()
 	defer r.mtx.Unlock()
 
+	// Include collected changes, as pulling requires a clean working tree.
+	if err := r.commitBatch(); err != nil {
+		return err
+	}
+
 	err := retry.OnError(retry.DefaultBackoff,
 		//nolint:gocritic
 		func(err error) bool {
@@ -143,6 +402,11 @@ func (r *RepositorySyncer) syncWithRetry() error {
 				return err
 			}
 
+			if err := r.verifyFiles(); err != nil {
+				r.logger.V(1).Error(err, "Verifying commit signatures failed")
+				return err
+			}
+
 			curHeadCommitHash, err := r.gitCli.GetHEADCommitHash()
 			if err != nil {
 				return err
@@ -166,5 +430,16 @@ func (r *RepositorySyncer) syncWithRetry() error {
 
 			return nil
 		})
-	return err
+	if err != nil {
+		return err
+	}
+
+	commit, err := r.gitCli.GetHEADCommitHash()
+	if err != nil {
+		return err
+	}
+	r.statusMtx.Lock()
+	r.lastSyncedCommit = commit
+	r.statusMtx.Unlock()
+	return nil
 }
@@ -0,0 +1,231 @@
+// SPDX-FileCopyrightText: 2020 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package git
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/go-logr/logr"
+)
+
+func TestBatchedCommits(t *testing.T) {
+	dir := t.TempDir()
+	remote := newBareRepository(t, dir)
+
+	g, err := newGit(&Options{
+		AbsLocalPath: filepath.Join(dir, "clone"),
+		RemoteURL:    remote,
+		BranchName:   "master",
+		AuthorName:   "certificate-bot",
+		AuthorEmail:  "certificate-bot@example.com",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Clone(); err != nil {
+		t.Fatal(err)
+	}
+	r := &RepositorySyncer{
+		logger:       logr.Discard(),
+		gitCli:       g,
+		mtx:          new(sync.Mutex),
+		syncSoon:     make(chan struct{}, 1),
+		batchSize:    3,
+		batchStarted: make(chan struct{}, 1),
+	}
+
+	for _, host := range []string{"a.tld", "b.tld", "c.tld", "d.tld"} {
+		file := filepath.Join(g.AbsLocalPath, host+".pem")
+		if err := os.WriteFile(file, []byte("certificate"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := r.AddFilesAndCommit("added certificate for "+host, file); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The first three changes are committed together, the fourth is pending until synchronized.
+	log := mustRun(t, g.AbsLocalPath, nil, "git", "log", "--format=%B%x00")
+	if commits := strings.Count(log, "\x00"); commits != 2 {
+		t.Fatalf("expected 2 commits including the initial one, got %d: %s", commits, log)
+	}
+	for _, expected := range []string{"added certificate for a.tld and 2 more", "- added certificate for c.tld"} {
+		if !strings.Contains(log, expected) {
+			t.Errorf("expected commit message to contain %q, got: %s", expected, log)
+		}
+	}
+
+	if err := r.syncWithRetry(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Files committed by us are not reported as changed by others.
+	isChanged, err := r.IsChangedByOthers(filepath.Join(g.AbsLocalPath, "a.tld.pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if isChanged {
+		t.Error("expected file committed by us not to be changed by others")
+	}
+
+	remoteLog := mustRun(t, remote, nil, "git", "log", "--format=%s")
+	if !strings.Contains(remoteLog, "added certificate for d.tld") {
+		t.Errorf("expected pending change to be pushed, got: %s", remoteLog)
+	}
+}
+
+func TestFailedBatchCommit(t *testing.T) {
+	dir := t.TempDir()
+	remote := newBareRepository(t, dir)
+
+	g, err := newGit(&Options{
+		AbsLocalPath: filepath.Join(dir, "clone"),
+		RemoteURL:    remote,
+		BranchName:   "master",
+		AuthorName:   "certificate-bot",
+		AuthorEmail:  "certificate-bot@example.com",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Clone(); err != nil {
+		t.Fatal(err)
+	}
+	r := &RepositorySyncer{
+		logger:       logr.Discard(),
+		gitCli:       g,
+		mtx:          new(sync.Mutex),
+		syncSoon:     make(chan struct{}, 1),
+		batchSize:    10,
+		batchStarted: make(chan struct{}, 1),
+	}
+
+	for _, host := range []string{"a.tld", "b.tld"} {
+		file := filepath.Join(g.AbsLocalPath, host+".pem")
+		if err := os.WriteFile(file, []byte("certificate"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := r.AddFilesAndCommit("added certificate for "+host, file); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	hook := filepath.Join(g.AbsLocalPath, ".git", "hooks", "pre-commit")
+	if err := os.WriteFile(hook, []byte("#!/bin/sh\nexit 1\n"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.commitBatch(); err == nil {
+		t.Fatal("expected commit to fail")
+	}
+	if len(r.batch.messages) != 2 {
+		t.Fatalf("expected changes to be kept after failed commit, got %v", r.batch.messages)
+	}
+
+	if err := os.Remove(hook); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.commitBatch(); err != nil {
+		t.Fatal(err)
+	}
+	if status := mustRun(t, g.AbsLocalPath, nil, "git", "status", "--short"); status != "" {
+		t.Errorf("expected all changes to be committed, got: %s", status)
+	}
+	if log := mustRun(t, g.AbsLocalPath, nil, "git", "log", "-1", "--format=%s"); !strings.Contains(log, "added certificate for a.tld and 1 more") {
+		t.Errorf("unexpected commit message: %s", log)
+	}
+}
+
+func TestIsChangedByOthers(t *testing.T) {
+	dir := t.TempDir()
+	remote := newBareRepository(t, dir)
+
+	g, err := newGit(&Options{
+		AbsLocalPath: filepath.Join(dir, "clone"),
+		RemoteURL:    remote,
+		BranchName:   "master",
+		AuthorName:   "certificate-bot",
+		AuthorEmail:  "certificate-bot@example.com",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Clone(); err != nil {
+		t.Fatal(err)
+	}
+	r := &RepositorySyncer{logger: logr.Discard(), gitCli: g}
+
+	file := filepath.Join(g.AbsLocalPath, "a.tld.pem")
+	isChanged, err := r.IsChangedByOthers(file)
+	if err != nil || isChanged {
+		t.Errorf("expected file not committed yet not to be changed by others, got %t, %v", isChanged, err)
+	}
+
+	if err := os.WriteFile(file, []byte("tampered"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	mustRun(t, g.AbsLocalPath, nil, "git", "add", file)
+	mustRun(t, g.AbsLocalPath, nil, "git", "-c", "user.name=someone", "-c", "user.email=someone@example.com", "commit", "--quiet", "--message", "tamper")
+	isChanged, err = r.IsChangedByOthers(file)
+	if err != nil || !isChanged {
+		t.Errorf("expected file committed by someone else to be changed by others, got %t, %v", isChanged, err)
+	}
+}
+
+func TestIsChangedByOthersShallowClone(t *testing.T) {
+	dir := t.TempDir()
+	remote := newBareRepository(t, dir)
+
+	// The certificate was committed by us, followed by an unrelated commit of someone else.
+	work := filepath.Join(dir, "work")
+	mustRun(t, "", nil, "git", "clone", "--quiet", remote, work)
+	for _, c := range []struct{ file, email string }{{"a.tld.pem", "certificate-bot@example.com"}, {"README.md", "someone@example.com"}} {
+		if err := os.WriteFile(filepath.Join(work, c.file), []byte(c.file), 0600); err != nil {
+			t.Fatal(err)
+		}
+		mustRun(t, work, nil, "git", "add", c.file)
+		mustRun(t, work, nil, "git", "-c", "user.name=test", "-c", "user.email="+c.email, "commit", "--quiet", "--message", "add "+c.file)
+	}
+	mustRun(t, work, nil, "git", "push", "--quiet", "origin", "master")
+
+	g, err := newGit(&Options{
+		AbsLocalPath: filepath.Join(dir, "clone"),
+		RemoteURL:    "file://" + remote,
+		BranchName:   "master",
+		AuthorName:   "certificate-bot",
+		AuthorEmail:  "certificate-bot@example.com",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Clone(); err != nil {
+		t.Fatal(err)
+	}
+	r := &RepositorySyncer{logger: logr.Discard(), gitCli: g}
+
+	isChanged, err := r.IsChangedByOthers(filepath.Join(g.AbsLocalPath, "a.tld.pem"))
+	if err != nil || isChanged {
+		t.Errorf("expected file committed by us not to be changed by others, got %t, %v", isChanged, err)
+	}
+	if isShallow := mustRun(t, g.AbsLocalPath, nil, "git", "rev-parse", "--is-shallow-repository"); strings.TrimSpace(isShallow) != "false" {
+		t.Error("expected the history to be fetched")
+	}
+}
+
+func TestBatchCommitMessageTrailers(t *testing.T) {
+	b := commitBatch{messages: []string{
+		"added certificate for a.tld\n\nCertificate-Serial: 01",
+		"renewed certificate for b.tld\n\nSome explanation.\n\nCertificate-Serial: 02\nCertificate-Change: renewed",
+		"added certificate for c.tld\n\nNo trailers here.",
+	}}
+	expected := "added certificate for a.tld and 2 more\n\n" +
+		"- added certificate for a.tld\n- renewed certificate for b.tld\n- added certificate for c.tld\n\n" +
+		"Certificate-Serial: 01\nCertificate-Serial: 02\nCertificate-Change: renewed"
+	if msg := b.message(); msg != expected {
+		t.Errorf("expected message %q, got %q", expected, msg)
+	}
+}
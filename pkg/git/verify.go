@@ -0,0 +1,146 @@
+// SPDX-FileCopyrightText: 2020 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package git
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// verifier checks whether commits are signed by a trusted key.
+type verifier struct {
+	// git runs git with the trusted keys configured for verification.
+	git *command
+	// isTrusted caches the result of the verification by commit hash.
+	isTrusted map[string]bool
+}
+
+// TrustedFile is the content of a file as of the last commit signed by a trusted key.
+type TrustedFile struct {
+	// Content is the content of the file. Nil if the file was never changed by a trusted commit.
+	Content []byte
+	// UntrustedCommit is the most recent commit that changed the file but is not signed by a trusted key.
+	// Empty if the most recent change is trusted.
+	UntrustedCommit string
+}
+
+func newVerifier(opts *Options) (*verifier, error) {
+	v := &verifier{
+		git: &command{
+			cmd:         "git",
+			defaultArgs: []string{"-C", opts.AbsLocalPath},
+			timeout:     time.Minute,
+		},
+		isTrusted: make(map[string]bool),
+	}
+
+	if opts.TrustedSSHSignersFile != "" {
+		if err := checkFileExistsAndIsNotEmpty(opts.TrustedSSHSignersFile); err != nil {
+			return nil, errors.Wrap(err, "invalid trusted SSH signers file")
+		}
+		v.git.defaultArgs = append(v.git.defaultArgs, "-c", "gpg.ssh.allowedSignersFile="+opts.TrustedSSHSignersFile)
+	}
+
+	// Use a keyring only containing the trusted keys, so no other key is accepted.
+	gnupgHome, err := os.MkdirTemp("", "git-cert-shim-trusted-gnupg")
+	if err != nil {
+		return nil, err
+	}
+	v.git.env = append(v.git.env, "GNUPGHOME="+gnupgHome)
+
+	if opts.TrustedGPGKeysFile != "" {
+		if err := checkFileExistsAndIsNotEmpty(opts.TrustedGPGKeysFile); err != nil {
+			return nil, errors.Wrap(err, "invalid trusted GPG keys file")
+		}
+		gpg := &command{cmd: "gpg", defaultArgs: []string{"--batch", "--homedir", gnupgHome}, timeout: time.Minute}
+		if res, err := gpg.run("--import", opts.TrustedGPGKeysFile); err != nil {
+			return nil, errors.Wrapf(err, "failed to import trusted GPG keys from %s: %s", opts.TrustedGPGKeysFile, res)
+		}
+	}
+
+	return v, nil
+}
+
+// isCommitTrusted returns whether the commit is signed by a trusted key.
+func (v *verifier) isCommitTrusted(commit string) bool {
+	if trusted, ok := v.isTrusted[commit]; ok {
+		return trusted
+	}
+	// verify-commit fails for unsigned commits as well as signatures by unknown keys.
+	_, err := v.git.run("verify-commit", commit)
+	v.isTrusted[commit] = err == nil
+	return err == nil
+}
+
+// TrustedFiles returns all files with the given name, which exist as of the last trusted change, by absolute path.
+// Files deleted by an untrusted commit are still returned.
+func (g *Git) TrustedFiles(name string) (map[string]TrustedFile, error) {
+	if g.verifier == nil {
+		return nil, errors.New("verification of commit signatures is not configured")
+	}
+
+	// All paths of files with this name ever committed, including deleted ones.
+	res, err := g.run("log", "--format=", "--name-only", "--", ":(glob)**/"+name)
+	if err != nil {
+		return nil, errors.Wrapf(err, "git log failed: %s", res)
+	}
+	var paths []string
+	for p := range strings.SplitSeq(res, "\n") {
+		p = strings.TrimSpace(p)
+		if p != "" && !slices.Contains(paths, p) {
+			paths = append(paths, p)
+		}
+	}
+
+	files := make(map[string]TrustedFile, len(paths))
+	for _, p := range paths {
+		f, exists, err := g.lastTrustedVersion(p)
+		if err != nil {
+			return nil, err
+		}
+		if exists || f.UntrustedCommit != "" {
+			files[filepath.Join(g.AbsLocalPath, p)] = f
+		}
+	}
+	return files, nil
+}
+
+// lastTrustedVersion returns the file as of the most recent commit changing it that is signed by a trusted key.
+// exists is false if the file does not exist as of that commit.
+func (g *Git) lastTrustedVersion(relPath string) (file TrustedFile, exists bool, err error) {
+	res, err := g.run("log", "--format=%H", "--", relPath)
+	if err != nil {
+		return TrustedFile{}, false, errors.Wrapf(err, "git log %s failed: %s", relPath, res)
+	}
+
+	for i, commit := range strings.Fields(res) {
+		if i == 0 {
+			file.UntrustedCommit = commit
+		}
+		if !g.verifier.isCommitTrusted(commit) {
+			continue
+		}
+		if i == 0 {
+			file.UntrustedCommit = ""
+		}
+
+		// The trusted commit might have deleted the file.
+		if _, err := g.run("cat-file", "-e", commit+":"+relPath); err != nil {
+			return file, false, nil //nolint:nilerr
+		}
+		content, err := g.run("show", commit+":"+relPath)
+		if err != nil {
+			return file, false, errors.Wrapf(err, "git show %s:%s failed", commit, relPath)
+		}
+		file.Content = []byte(content + "\n")
+		return file, true, nil
+	}
+
+	return file, false, nil
+}
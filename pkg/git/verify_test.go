@@ -0,0 +1,105 @@
+// SPDX-FileCopyrightText: 2020 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package git
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTrustedFiles(t *testing.T) {
+	requireCommands(t, "ssh-keygen")
+	dir := t.TempDir()
+
+	keyFile := filepath.Join(dir, "id_ed25519")
+	mustRun(t, "", nil, "ssh-keygen", "-q", "-t", "ed25519", "-N", "", "-C", "admin", "-f", keyFile)
+	publicKey, err := os.ReadFile(keyFile + ".pub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	allowedSigners := filepath.Join(dir, "allowed_signers")
+	if err := os.WriteFile(allowedSigners, []byte("* "+string(publicKey)), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	remote := newBareRepository(t, dir)
+	work := filepath.Join(dir, "work")
+	mustRun(t, "", nil, "git", "clone", "--quiet", remote, work)
+	commit := func(file, content string, signed bool) {
+		path := filepath.Join(work, file)
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if content == "" {
+			mustRun(t, work, nil, "git", "rm", "--quiet", file)
+		} else {
+			if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+				t.Fatal(err)
+			}
+			mustRun(t, work, nil, "git", "add", file)
+		}
+		args := []string{"-c", "user.name=test", "-c", "user.email=test@example.com"}
+		if signed {
+			args = append(args, "-c", "gpg.format=ssh", "-c", "user.signingkey="+keyFile, "-c", "commit.gpgsign=true")
+		}
+		mustRun(t, work, nil, "git", append(args, "commit", "--quiet", "--message", "change "+file)...)
+	}
+
+	commit("a/git-cert-shim.yaml", "certificates:\n  - cn: a.tld\n", true)
+	commit("a/git-cert-shim.yaml", "certificates:\n  - cn: evil.tld\n", false)
+	commit("b/git-cert-shim.yaml", "certificates:\n  - cn: b.tld\n", true)
+	commit("b/git-cert-shim.yaml", "", false)
+	commit("c/git-cert-shim.yaml", "certificates:\n  - cn: c.tld\n", false)
+	commit("d/git-cert-shim.yaml", "certificates:\n  - cn: d.tld\n", true)
+	commit("d/git-cert-shim.yaml", "", true)
+	mustRun(t, work, nil, "git", "push", "--quiet", "origin", "master")
+
+	g, err := newGit(&Options{
+		AbsLocalPath:          filepath.Join(dir, "clone"),
+		RemoteURL:             remote,
+		BranchName:            "master",
+		TrustedSSHSignersFile: allowedSigners,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Clone(); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := g.TrustedFiles("git-cert-shim.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]struct {
+		content     string
+		isUntrusted bool
+	}{
+		// Unsigned change is ignored.
+		"a/git-cert-shim.yaml": {"cn: a.tld", true},
+		// Unsigned deletion is ignored.
+		"b/git-cert-shim.yaml": {"cn: b.tld", true},
+		// Never signed.
+		"c/git-cert-shim.yaml": {"", true},
+	}
+	if len(files) != len(expected) {
+		t.Errorf("expected %d files, got %d: %v", len(expected), len(files), files)
+	}
+	for name, e := range expected {
+		f, ok := files[filepath.Join(g.AbsLocalPath, name)]
+		if !ok {
+			t.Errorf("expected file %s", name)
+			continue
+		}
+		if (f.UntrustedCommit != "") != e.isUntrusted {
+			t.Errorf("file %s: expected untrusted %t, got commit %q", name, e.isUntrusted, f.UntrustedCommit)
+		}
+		if e.content == "" && f.Content != nil || !strings.Contains(string(f.Content), e.content) {
+			t.Errorf("file %s: expected content %q, got %q", name, e.content, f.Content)
+		}
+	}
+}
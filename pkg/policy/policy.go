@@ -0,0 +1,180 @@
+// SPDX-FileCopyrightText: 2020 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package policy
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/sapcc/git-cert-shim/pkg/certificate"
+)
+
+// ErrViolation is returned if a certificate is not allowed by the policy.
+var ErrViolation = errors.New("domain policy violation")
+
+// Policy restricts the domains certificates may be requested for by the folder containing the configuration.
+// Similar to a CODEOWNERS file, each line consists of a path followed by the domains allowed below that path.
+// The last rule matching the folder applies.
+//
+//	# <path> <domain>...
+//	/                  example.com
+//	/team-a/           team-a.example.com *.team-a.example.com
+//	/team-b/*/ingress/ team-b.example.com
+//
+// Paths are relative to the root of the repository and match the folder and all folders below it.
+// A path segment may contain the wildcards supported by path.Match.
+// A domain allows itself and all its subdomains. Wildcard certificates, e.g. *.a.example.com,
+// are only allowed by a wildcard domain, e.g. *.example.com, which allows the same as example.com in addition.
+// A rule without domains does not allow any certificate. Folders without matching rule do not allow any certificate.
+type Policy struct {
+	rules []rule
+}
+
+type rule struct {
+	line     int
+	pattern  []string
+	domains  []string
+	original string
+}
+
+// ReadFile reads the policy from the given file.
+func ReadFile(filePath string) (*Policy, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	p, err := Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse domain policy %s: %w", filePath, err)
+	}
+	return p, nil
+}
+
+// Parse reads the policy from the given reader.
+func Parse(r io.Reader) (*Policy, error) {
+	var (
+		p       = new(Policy)
+		scanner = bufio.NewScanner(r)
+		line    = 0
+	)
+	for scanner.Scan() {
+		line++
+		text, _, _ := strings.Cut(scanner.Text(), "#")
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			continue
+		}
+
+		pattern := splitPath(fields[0])
+		for _, segment := range pattern {
+			if _, err := path.Match(segment, ""); err != nil {
+				return nil, fmt.Errorf("line %d: invalid path %q: %w", line, fields[0], err)
+			}
+		}
+
+		domains := make([]string, 0, len(fields)-1)
+		for _, d := range fields[1:] {
+			d = strings.ToLower(strings.TrimSuffix(d, "."))
+			if strings.Contains(strings.TrimPrefix(d, "*."), "*") {
+				return nil, fmt.Errorf("line %d: invalid domain %q: wildcards are only allowed as first label", line, d)
+			}
+			domains = append(domains, d)
+		}
+
+		p.rules = append(p.rules, rule{
+			line:     line,
+			pattern:  pattern,
+			domains:  domains,
+			original: fields[0],
+		})
+	}
+	return p, scanner.Err()
+}
+
+// CheckCertificate checks whether the common name and SANs of the certificate are allowed
+// in the folder containing its configuration. root is the root of the repository.
+func (p *Policy) CheckCertificate(root string, cert *certificate.Certificate) error {
+	folder, err := filepath.Rel(root, filepath.Dir(cert.ConfigFile))
+	if err != nil {
+		return err
+	}
+	return p.Check(filepath.ToSlash(folder), append([]string{cert.CommonName}, cert.SANS...)...)
+}
+
+// Check checks whether the given domains are allowed in the folder, which is relative to the root of the repository.
+func (p *Policy) Check(folder string, domains ...string) error {
+	r := p.match(folder)
+	if r == nil {
+		return fmt.Errorf("%w: no rule matches folder %q", ErrViolation, folder)
+	}
+
+	for _, d := range domains {
+		if !r.allows(d) {
+			if len(r.domains) == 0 {
+				return fmt.Errorf("%w: domain %q is not allowed in folder %q: rule %q in line %d allows no domains", ErrViolation, d, folder, r.original, r.line)
+			}
+			return fmt.Errorf("%w: domain %q is not allowed in folder %q: rule %q in line %d only allows %s",
+				ErrViolation, d, folder, r.original, r.line, strings.Join(r.domains, ", "))
+		}
+	}
+	return nil
+}
+
+// match returns the last rule matching the folder or nil.
+func (p *Policy) match(folder string) *rule {
+	segments := splitPath(folder)
+	for i := len(p.rules) - 1; i >= 0; i-- {
+		if p.rules[i].matches(segments) {
+			return &p.rules[i]
+		}
+	}
+	return nil
+}
+
+func (r *rule) matches(segments []string) bool {
+	if len(r.pattern) > len(segments) {
+		return false
+	}
+	for i, pattern := range r.pattern {
+		if ok, _ := path.Match(pattern, segments[i]); !ok { //nolint:errcheck
+			return false
+		}
+	}
+	return true
+}
+
+func (r *rule) allows(domain string) bool {
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+	isWildcard := strings.HasPrefix(domain, "*.")
+	name := strings.TrimPrefix(domain, "*.")
+
+	for _, d := range r.domains {
+		allowsWildcard := strings.HasPrefix(d, "*.")
+		suffix := strings.TrimPrefix(d, "*.")
+		if isWildcard && !allowsWildcard {
+			continue
+		}
+		if name == suffix || strings.HasSuffix(name, "."+suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// splitPath splits the path into its segments ignoring leading and trailing slashes.
+func splitPath(p string) []string {
+	p = strings.Trim(path.Clean("/"+p), "/")
+	if p == "" {
+		return nil
+	}
+	return strings.Split(p, "/")
+}
@@ -0,0 +1,75 @@
+// SPDX-FileCopyrightText: 2020 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package policy
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+const testPolicy = `
+# <path> <domain>...
+/                   example.com
+/team-a/            team-a.example.com *.team-a.example.com
+/team-b/*/ingress/  team-b.example.com
+/team-a/legacy      # nothing allowed
+`
+
+func TestCheck(t *testing.T) {
+	p, err := Parse(strings.NewReader(testPolicy))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		folder    string
+		domains   []string
+		isAllowed bool
+	}{
+		{".", []string{"example.com", "foo.example.com"}, true},
+		{"other", []string{"foo.bar.example.com"}, true},
+		{"other", []string{"example.org"}, false},
+		{"other", []string{"*.example.com"}, false},
+		{"other", []string{"badexample.com"}, false},
+		{"team-a", []string{"team-a.example.com", "*.team-a.example.com", "*.sub.team-a.example.com"}, true},
+		{"team-a/app", []string{"App.Team-A.example.com."}, true},
+		{"team-a", []string{"team-b.example.com"}, false},
+		{"team-a/legacy/app", []string{"team-a.example.com"}, false},
+		{"team-b/eu-de-1/ingress", []string{"foo.team-b.example.com"}, true},
+		{"team-b/eu-de-1/ingress", []string{"*.team-b.example.com"}, false},
+		{"team-b/eu-de-1", []string{"foo.team-b.example.com"}, true},
+		{"team-b/eu-de-1", []string{"foo.team-b.example.org"}, false},
+	}
+	for _, tt := range tests {
+		err := p.Check(tt.folder, tt.domains...)
+		if tt.isAllowed && err != nil {
+			t.Errorf("expected %v to be allowed in folder %q, got: %s", tt.domains, tt.folder, err.Error())
+		}
+		if !tt.isAllowed && !errors.Is(err, ErrViolation) {
+			t.Errorf("expected %v not to be allowed in folder %q, got: %v", tt.domains, tt.folder, err)
+		}
+	}
+}
+
+func TestCheckWithoutMatchingRule(t *testing.T) {
+	p, err := Parse(strings.NewReader("/team-a/ team-a.example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Check("team-b", "team-a.example.com"); !errors.Is(err, ErrViolation) || !strings.Contains(err.Error(), "no rule matches") {
+		t.Errorf("expected violation as no rule matches, got: %v", err)
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, policy := range []string{
+		"/team-a/ foo.*.example.com",
+		"/team-[a/ example.com",
+	} {
+		if _, err := Parse(strings.NewReader(policy)); err == nil {
+			t.Errorf("expected error parsing %q", policy)
+		}
+	}
+}
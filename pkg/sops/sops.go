@@ -0,0 +1,255 @@
+// SPDX-FileCopyrightText: 2020 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package sops
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+)
+
+// Version is the SOPS version the written files are compatible with.
+const Version = "3.9.0"
+
+// dataKey is the key the content is stored under by the binary store of SOPS.
+const dataKey = "data"
+
+var (
+	// ErrNotEncrypted is returned when decrypting a file not encrypted by SOPS.
+	ErrNotEncrypted = errors.New("not encrypted by sops")
+
+	encryptedValueRegex = regexp.MustCompile(`^ENC\[AES256_GCM,data:(.*),iv:(.+),tag:(.+),type:(.+)\]$`)
+)
+
+// file is the format written by the binary store of SOPS, i.e. for files neither YAML, JSON, INI nor dotenv.
+// The content is decrypted via `sops --decrypt <file>`.
+type file struct {
+	Data string    `json:"data"`
+	SOPS *metadata `json:"sops"`
+}
+
+type metadata struct {
+	Age               []ageKey `json:"age"`
+	LastModified      string   `json:"lastmodified"`
+	MAC               string   `json:"mac"`
+	UnencryptedSuffix string   `json:"unencrypted_suffix"`
+	Version           string   `json:"version"`
+}
+
+type ageKey struct {
+	Recipient string `json:"recipient"`
+	// Enc is the data key encrypted for the recipient in armored age format.
+	Enc string `json:"enc"`
+}
+
+// ParseRecipients parses the age recipients, i.e. public keys starting with age1.
+func ParseRecipients(recipients []string) ([]age.Recipient, error) {
+	res := make([]age.Recipient, 0, len(recipients))
+	for _, r := range recipients {
+		recipient, err := age.ParseX25519Recipient(r)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, recipient)
+	}
+	return res, nil
+}
+
+// ReadIdentities reads the age identities, i.e. private keys starting with AGE-SECRET-KEY-1, from the file.
+func ReadIdentities(fileName string) ([]age.Identity, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return age.ParseIdentities(f)
+}
+
+// Encrypt encrypts the content for the given age recipients in the format of SOPS.
+func Encrypt(content []byte, recipients []string, now time.Time) ([]byte, error) {
+	if len(recipients) == 0 {
+		return nil, errors.New("no age recipients given")
+	}
+	parsed, err := ParseRecipients(recipients)
+	if err != nil {
+		return nil, err
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+
+	lastModified := now.UTC().Format(time.RFC3339)
+	meta := &metadata{LastModified: lastModified, UnencryptedSuffix: "_unencrypted", Version: Version}
+	for i, r := range parsed {
+		var buf bytes.Buffer
+		aw := armor.NewWriter(&buf)
+		w, err := age.Encrypt(aw, r)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(key); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		if err := aw.Close(); err != nil {
+			return nil, err
+		}
+		meta.Age = append(meta.Age, ageKey{Recipient: recipients[i], Enc: buf.String()})
+	}
+
+	f := file{SOPS: meta}
+	if f.Data, err = encryptValue(string(content), key, dataKey+":"); err != nil {
+		return nil, err
+	}
+	if meta.MAC, err = encryptValue(mac(content), key, lastModified); err != nil {
+		return nil, err
+	}
+	res, err := json.MarshalIndent(f, "", "\t")
+	if err != nil {
+		return nil, err
+	}
+	return append(res, '\n'), nil
+}
+
+// Decrypt decrypts the content of a file encrypted by Encrypt or SOPS using one of the given age identities.
+func Decrypt(content []byte, identities []age.Identity) ([]byte, error) {
+	f, err := parse(content)
+	if err != nil {
+		return nil, err
+	}
+
+	var key []byte
+	for _, k := range f.SOPS.Age {
+		r, err := age.Decrypt(armor.NewReader(strings.NewReader(k.Enc)), identities...)
+		if err != nil {
+			continue
+		}
+		if key, err = io.ReadAll(r); err == nil {
+			break
+		}
+	}
+	if key == nil {
+		return nil, errors.New("failed to decrypt the data key with any of the identities")
+	}
+
+	plaintext, err := decryptValue(f.Data, key, dataKey+":")
+	if err != nil {
+		return nil, err
+	}
+	expectedMAC, err := decryptValue(f.SOPS.MAC, key, f.SOPS.LastModified)
+	if err != nil {
+		return nil, fmt.Errorf("invalid MAC: %w", err)
+	}
+	if mac([]byte(plaintext)) != expectedMAC {
+		return nil, errors.New("MAC mismatch: the file was modified")
+	}
+	return []byte(plaintext), nil
+}
+
+// IsEncrypted returns whether the content is a file encrypted by SOPS.
+func IsEncrypted(content []byte) bool {
+	_, err := parse(content)
+	return err == nil
+}
+
+// IsEncryptedFor returns whether the content is a file encrypted by SOPS for exactly the given age recipients.
+func IsEncryptedFor(content []byte, recipients []string) bool {
+	f, err := parse(content)
+	if err != nil || len(f.SOPS.Age) != len(recipients) {
+		return false
+	}
+	for _, k := range f.SOPS.Age {
+		if !slices.Contains(recipients, k.Recipient) {
+			return false
+		}
+	}
+	return true
+}
+
+func parse(content []byte) (*file, error) {
+	var f file
+	if !bytes.HasPrefix(bytes.TrimSpace(content), []byte("{")) || json.Unmarshal(content, &f) != nil || f.SOPS == nil {
+		return nil, ErrNotEncrypted
+	}
+	return &f, nil
+}
+
+// mac returns the message authentication code as computed by SOPS over all values.
+func mac(content []byte) string {
+	return fmt.Sprintf("%X", sha512.Sum512(content))
+}
+
+// encryptValue encrypts the value as done by SOPS using AES-256-GCM with a 32 byte nonce.
+// The additional data is the path of the value or, for the MAC, the time of the last modification.
+func encryptValue(value string, key []byte, additionalData string) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	iv := make([]byte, 32)
+	if _, err := rand.Read(iv); err != nil {
+		return "", err
+	}
+	out := gcm.Seal(nil, iv, []byte(value), []byte(additionalData))
+	data, tag := out[:len(out)-gcm.Overhead()], out[len(out)-gcm.Overhead():]
+	return fmt.Sprintf("ENC[AES256_GCM,data:%s,iv:%s,tag:%s,type:str]",
+		base64.StdEncoding.EncodeToString(data), base64.StdEncoding.EncodeToString(iv), base64.StdEncoding.EncodeToString(tag)), nil
+}
+
+func decryptValue(value string, key []byte, additionalData string) (string, error) {
+	m := encryptedValueRegex.FindStringSubmatch(value)
+	if m == nil {
+		return "", errors.New("invalid encrypted value")
+	}
+	if m[4] != "str" {
+		return "", fmt.Errorf("unsupported value type %s", m[4])
+	}
+	var parts [3][]byte
+	for i := range parts {
+		var err error
+		if parts[i], err = base64.StdEncoding.DecodeString(m[i+1]); err != nil {
+			return "", err
+		}
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	if len(parts[1]) != gcm.NonceSize() {
+		return "", errors.New("invalid IV")
+	}
+	plaintext, err := gcm.Open(nil, parts[1], append(parts[0], parts[2]...), []byte(additionalData))
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCMWithNonceSize(block, 32)
+}
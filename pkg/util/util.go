@@ -29,6 +29,12 @@ func FindFilesInPath(path, filename string) ([]string, error) {
 	return res, err
 }
 
+// IsWithin returns whether the path is the given root or below it.
+func IsWithin(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
 func EnsureDir(path string, isEnsureEmptyDir bool) error {
 	if isEnsureEmptyDir {
 		p := path
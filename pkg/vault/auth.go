@@ -0,0 +1,163 @@
+// SPDX-FileCopyrightText: 2020 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package vault
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	vaultapi "github.com/hashicorp/vault/api"
+)
+
+const (
+	// AuthAppRole logs in with the role ID and secret ID given in VAULT_ROLE_ID and VAULT_SECRET_ID, see AuthOptions.EnvVarPrefix.
+	AuthAppRole = "approle"
+	// AuthKubernetes logs in with the token of the service account of the pod.
+	AuthKubernetes = "kubernetes"
+	// AuthJWT logs in with a JWT, e.g. an OIDC ID token, read from a file.
+	AuthJWT = "jwt"
+	// AuthToken uses a Vault token read from a file, e.g. written by the Vault agent.
+	AuthToken = "token"
+)
+
+// AuthMethods are the supported methods to authenticate with Vault.
+var AuthMethods = []string{AuthAppRole, AuthKubernetes, AuthJWT, AuthToken}
+
+// DefaultServiceAccountTokenFile is the token of the service account projected into the pod.
+const DefaultServiceAccountTokenFile = "/var/run/secrets/kubernetes.io/serviceaccount/token" //nolint:gosec
+
+// AuthOptions configure how the client authenticates with Vault.
+type AuthOptions struct {
+	// Method is one of AuthMethods. Defaults to AuthAppRole.
+	Method string
+	// Mount is the path the auth method is mounted at. Defaults to the name of the method.
+	Mount string
+	// Role is the role to log in with. Required for AuthKubernetes and AuthJWT.
+	Role string
+	// TokenFile contains the JWT for AuthKubernetes and AuthJWT or the Vault token for AuthToken.
+	// Read on each login, so rotated tokens are picked up. Defaults to DefaultServiceAccountTokenFile for AuthKubernetes.
+	TokenFile string
+	// EnvVarPrefix is the prefix of the environment variables containing the credentials of AuthAppRole,
+	// e.g. VAULT for VAULT_ROLE_ID. Defaults to VAULT.
+	EnvVarPrefix string
+}
+
+func (o *AuthOptions) setDefaults() {
+	if o.Method == "" {
+		o.Method = AuthAppRole
+	}
+	if o.Mount == "" {
+		o.Mount = o.Method
+	}
+	if o.Method == AuthKubernetes && o.TokenFile == "" {
+		o.TokenFile = DefaultServiceAccountTokenFile
+	}
+	if o.EnvVarPrefix == "" {
+		o.EnvVarPrefix = "VAULT"
+	}
+}
+
+// validate checks the options and reads the credentials of AuthAppRole from the environment.
+func (o *AuthOptions) validate() (roleID, secretID string, err error) {
+	if !slices.Contains(AuthMethods, o.Method) {
+		return "", "", fmt.Errorf("unsupported Vault auth method %q, must be one of %s", o.Method, strings.Join(AuthMethods, ", "))
+	}
+	switch o.Method {
+	case AuthAppRole:
+		roleID = os.Getenv(o.EnvVarPrefix + "_ROLE_ID")
+		if roleID == "" {
+			return "", "", errors.New("missing required environment variable: " + o.EnvVarPrefix + "_ROLE_ID")
+		}
+		secretID = os.Getenv(o.EnvVarPrefix + "_SECRET_ID")
+		if secretID == "" {
+			return "", "", errors.New("missing required environment variable: " + o.EnvVarPrefix + "_SECRET_ID")
+		}
+	case AuthKubernetes, AuthJWT:
+		if o.Role == "" {
+			return "", "", fmt.Errorf("no value given for --vault-auth-role, required for auth method %s", o.Method)
+		}
+		if o.TokenFile == "" {
+			return "", "", fmt.Errorf("no value given for --vault-auth-token-file, required for auth method %s", o.Method)
+		}
+	case AuthToken:
+		if o.TokenFile == "" {
+			return "", "", errors.New("no value given for --vault-auth-token-file, required for auth method token")
+		}
+	}
+	return roleID, secretID, nil
+}
+
+// login obtains a token and returns how long it is valid and whether it is renewable. Zero means the token does not expire.
+func (a *authState) login(client *vaultapi.Client) (time.Duration, bool, error) {
+	if a.options.Method == AuthToken {
+		return a.loginWithToken(client)
+	}
+
+	var data map[string]any
+	switch a.options.Method {
+	case AuthAppRole:
+		data = map[string]any{
+			"role_id":   a.roleID,
+			"secret_id": a.secretID,
+		}
+	default:
+		jwt, err := readTokenFile(a.options.TokenFile)
+		if err != nil {
+			return 0, false, err
+		}
+		data = map[string]any{
+			"role": a.options.Role,
+			"jwt":  jwt,
+		}
+	}
+
+	resp, err := client.Logical().Write("auth/"+a.options.Mount+"/login", data)
+	if err != nil {
+		return 0, false, fmt.Errorf("while obtaining %s token: %w", a.options.Method, err)
+	}
+	if resp == nil || resp.Auth == nil {
+		return 0, false, fmt.Errorf("while obtaining %s token: no token returned", a.options.Method)
+	}
+	client.SetToken(resp.Auth.ClientToken)
+	return time.Duration(resp.Auth.LeaseDuration) * time.Second, resp.Auth.Renewable, nil
+}
+
+// loginWithToken uses the token from the file and looks up how long it is valid.
+func (a *authState) loginWithToken(client *vaultapi.Client) (time.Duration, bool, error) {
+	token, err := readTokenFile(a.options.TokenFile)
+	if err != nil {
+		return 0, false, err
+	}
+	client.SetToken(token)
+
+	secret, err := client.Auth().Token().LookupSelf()
+	if err != nil {
+		return 0, false, fmt.Errorf("while looking up token: %w", err)
+	}
+	ttl, err := secret.TokenTTL()
+	if err != nil {
+		return 0, false, fmt.Errorf("while looking up token: %w", err)
+	}
+	renewable, err := secret.TokenIsRenewable()
+	if err != nil {
+		return 0, false, fmt.Errorf("while looking up token: %w", err)
+	}
+	return ttl, renewable, nil
+}
+
+func readTokenFile(fileName string) (string, error) {
+	content, err := os.ReadFile(fileName)
+	if err != nil {
+		return "", fmt.Errorf("while reading token: %w", err)
+	}
+	token := strings.TrimSpace(string(content))
+	if token == "" {
+		return "", fmt.Errorf("token file %s is empty", fileName)
+	}
+	return token, nil
+}
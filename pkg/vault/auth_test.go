@@ -0,0 +1,58 @@
+// SPDX-FileCopyrightText: 2020 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package vault
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAuthMethods(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("some-jwt\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	vault := newFakeVault(t, nil)
+
+	tests := []struct {
+		auth          AuthOptions
+		expectedToken string
+		expectedTTL   time.Duration
+	}{
+		{AuthOptions{Method: AuthKubernetes, Mount: "k8s", Role: "git-cert-shim", TokenFile: tokenFile}, "token-1", 600 * time.Second},
+		{AuthOptions{Method: AuthJWT, Role: "git-cert-shim", TokenFile: tokenFile}, "token-2", 600 * time.Second},
+		{AuthOptions{Method: AuthToken, TokenFile: tokenFile}, "some-jwt", tokenRecheckInterval},
+	}
+	for _, tt := range tests {
+		c, err := NewClientIfSelected(Options{KVEngineName: "secrets", KVVersion: 2, Auth: tt.auth})
+		if err != nil {
+			t.Fatalf("%s: %s", tt.auth.Method, err.Error())
+		}
+		if c.client.Token() != tt.expectedToken {
+			t.Errorf("%s: unexpected token %q", tt.auth.Method, c.client.Token())
+		}
+		if ttl := time.Until(c.auth.validUntil); ttl > tt.expectedTTL || ttl < tt.expectedTTL-time.Minute {
+			t.Errorf("%s: unexpected TTL %s", tt.auth.Method, ttl)
+		}
+	}
+
+	for _, request := range []string{"PUT auth/k8s/login", "PUT auth/jwt/login"} {
+		login, ok := vault.lastRequest(request)
+		if !ok || login.body["role"] != "git-cert-shim" || login.body["jwt"] != "some-jwt" {
+			t.Errorf("%s: unexpected login %v", request, login.body)
+		}
+	}
+	if lookup, ok := vault.lastRequest("GET auth/token/lookup-self"); !ok || lookup.token != "some-jwt" {
+		t.Errorf("unexpected token %q looked up", lookup.token)
+	}
+
+	for _, invalid := range []AuthOptions{{Method: "ldap"}, {Method: AuthJWT, TokenFile: tokenFile}, {Method: AuthToken}} {
+		if _, err := NewClientIfSelected(Options{KVEngineName: "secrets", KVVersion: 2, Auth: invalid}); err == nil {
+			t.Errorf("expected error for %+v", invalid)
+		}
+	}
+}
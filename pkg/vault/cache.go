@@ -0,0 +1,85 @@
+// SPDX-FileCopyrightText: 2020 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package vault
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+	"time"
+
+	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// cacheDigest identifies what is written for the certificate: the payload and everything the custom metadata is
+// rendered from.
+func (c *Client) cacheDigest(data CertificateData, certStatus certmanagerv1.CertificateStatus) (string, error) {
+	payload, err := c.payload(data)
+	if err != nil {
+		return "", err
+	}
+	// Maps are encoded with sorted keys.
+	content, err := json.Marshal(struct {
+		Payload     map[string]any
+		Certificate []byte
+		Metadata    map[string]string
+		Owners      []string
+		NotAfter    *metav1.Time
+		RenewalTime *metav1.Time
+	}{payload, data.CertBytes, data.Metadata, data.Owners, certStatus.NotAfter, certStatus.RenewalTime})
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// isCached returns whether the secret was written with the given digest recently, so Vault need not be contacted.
+func (c *Client) isCached(vaultPath, digest string, now time.Time) bool {
+	c.managed.mtx.Lock()
+	defer c.managed.mtx.Unlock()
+	s, ok := c.managed.secrets[c.secretLocation(vaultPath)]
+	return ok && s.digest == digest && now.Before(s.cachedUntil)
+}
+
+// invalidateCache makes the next update of the secret contact Vault.
+func (c *Client) invalidateCache(vaultPath string) {
+	c.managed.mtx.Lock()
+	defer c.managed.mtx.Unlock()
+	if s, ok := c.managed.secrets[c.secretLocation(vaultPath)]; ok {
+		s.cachedUntil = time.Time{}
+	}
+}
+
+// readValues are secrets read by ReadValue, e.g. passwords, cached for CacheTTL.
+type readValues struct {
+	mtx     sync.Mutex
+	secrets map[secretLocation]readValue
+}
+
+type readValue struct {
+	secret      map[string]any
+	cachedUntil time.Time
+}
+
+// cachedSecret returns the secret read recently. Nil if not cached.
+func (c *Client) cachedSecret(vaultPath string, now time.Time) map[string]any {
+	c.values.mtx.Lock()
+	defer c.values.mtx.Unlock()
+	if v, ok := c.values.secrets[c.secretLocation(vaultPath)]; ok && now.Before(v.cachedUntil) {
+		return v.secret
+	}
+	return nil
+}
+
+func (c *Client) cacheSecret(vaultPath string, secret map[string]any, now time.Time) {
+	if c.Options.CacheTTL <= 0 || secret == nil {
+		return
+	}
+	c.values.mtx.Lock()
+	defer c.values.mtx.Unlock()
+	c.values.secrets[c.secretLocation(vaultPath)] = readValue{secret: secret, cachedUntil: now.Add(c.Options.CacheTTL)}
+}
@@ -0,0 +1,71 @@
+// SPDX-FileCopyrightText: 2020 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package vault
+
+import (
+	"testing"
+	"time"
+
+	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/sapcc/git-cert-shim/pkg/certificate/certtest"
+)
+
+func TestCache(t *testing.T) {
+	vault := newFakeVault(t, nil)
+
+	c, err := NewClientIfSelected(Options{KVEngineName: "kv1", KVVersion: 1, PushCertificates: true, CacheTTL: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := CertificateData{VaultPath: "certs/a", CertBytes: certtest.NewCertificate(t, "Test CA", 42, "a.tld"), KeyBytes: []byte("key")}
+	update := func(status certmanagerv1.CertificateStatus) int {
+		before := vault.numRequests()
+		if err := c.UpdateCertificate(data, status); err != nil {
+			t.Fatal(err)
+		}
+		return vault.numRequests() - before
+	}
+
+	if n := update(certmanagerv1.CertificateStatus{}); n == 0 {
+		t.Error("expected requests when writing the certificate")
+	}
+	if n := update(certmanagerv1.CertificateStatus{}); n != 0 {
+		t.Errorf("expected no requests for unchanged certificate, got %d", n)
+	}
+
+	// A renewal changes the metadata, even if the secret did not change yet.
+	renewal := metav1.NewTime(time.Date(2027, 2, 2, 5, 6, 7, 0, time.UTC))
+	if n := update(certmanagerv1.CertificateStatus{RenewalTime: &renewal}); n == 0 {
+		t.Error("expected requests for changed status")
+	}
+
+	c.invalidateCache(data.VaultPath)
+	if n := update(certmanagerv1.CertificateStatus{RenewalTime: &renewal}); n == 0 {
+		t.Error("expected requests after invalidating the cache")
+	}
+
+	digest, err := c.cacheDigest(data, certmanagerv1.CertificateStatus{RenewalTime: &renewal})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.isCached(data.VaultPath, digest, time.Now()) || c.isCached(data.VaultPath, digest, time.Now().Add(2*time.Hour)) {
+		t.Error("expected cache entry to expire after the TTL")
+	}
+
+	// Secrets read, e.g. passwords, are cached as well.
+	vault.update(func() {
+		vault.secrets["kv1/keystores/a"] = map[string]any{"password": "secret"}
+	})
+	before := vault.numRequests()
+	for range 2 {
+		if value, err := c.ReadValue("keystores/a", "password"); err != nil || value != "secret" {
+			t.Errorf("unexpected value %q (%v)", value, err)
+		}
+	}
+	if n := vault.numRequests() - before; n != 1 {
+		t.Errorf("expected one request for reading the secret twice, got %d", n)
+	}
+}
@@ -9,169 +9,348 @@ import (
 	"fmt"
 	"os"
 	"reflect"
-	"sync"
 	"time"
 
 	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
 	"github.com/go-logr/logr"
 	vaultapi "github.com/hashicorp/vault/api"
 	ctrl "sigs.k8s.io/controller-runtime"
+
+	"github.com/sapcc/git-cert-shim/pkg/certificate"
 )
 
+// DefaultTarget is the name of the Vault configured via flags and environment variables.
+const DefaultTarget = "default"
+
 type Options struct {
+	// Name identifies the Vault in logs and metrics. Defaults to DefaultTarget.
+	Name string
+	// Address of the Vault. Defaults to VAULT_ADDR.
+	Address string
+	// Namespace of the KV engine in Vault Enterprise. The namespace the client is created with, defaulting to
+	// VAULT_NAMESPACE, is also used to log in.
+	Namespace        string
 	PushCertificates bool
 	UpdateMetaData   bool
 	KVEngineName     string
-	authRoleID       string
-	authSecretID     string
+	// Payload are the fields written for certificates, see PayloadFields. Defaults to DefaultPayloadFields.
+	Payload []string
+	// KeyNames rename the keys of fields in the payload, e.g. certificate to tls.crt.
+	KeyNames map[string]string
+	// Metadata are the templates of the custom metadata written for certificates, see MetadataData.
+	// Defaults to DefaultMetadata.
+	Metadata map[string]string
+	// KVVersion is the version of the KV engine, 1 or 2. Detected from the mount of the engine if not given.
+	KVVersion int
+	// RetirePolicy is applied to the secrets of certificates that are no longer configured, see RetirePolicies.
+	// Defaults to RetireKeep.
+	RetirePolicy string
+	// MaxVersions sets max_versions of the secrets written. Zero keeps the setting of the secret or engine.
+	MaxVersions int
+	// DriftCheckInterval is how often the secrets written are checked to still hold the certificate, see WatchDrift.
+	DriftCheckInterval time.Duration
+	// CacheTTL is how long Vault is not contacted for certificates that did not change since they were written.
+	// Zero disables the cache.
+	CacheTTL time.Duration
+	// Auth configures the authentication. Only used when creating the client, clients derived from it share the authentication.
+	Auth AuthOptions
 }
 
 type Client struct {
 	client  *vaultapi.Client
 	Options Options
 	Log     logr.Logger
-
-	authMutex      sync.Mutex
-	authValidUntil time.Time
+	auth    *authState
+	engines *engineVersions
+	managed *managedSecrets
+	values  *readValues
 }
 
 // Returns (nil, nil) if Vault support is not selected through the respective CLI options.
 func NewClientIfSelected(opts Options) (*Client, error) {
+	c, err := NewClient(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// authenticate once immediately to check correctness of credentials
+	if err := c.authenticateIfNecessary(); err != nil {
+		return nil, err
+	}
+	// detect the version of the engine immediately to fail early
+	if _, err := c.kvVersion(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// NewClient validates the options and creates a client without contacting Vault. Logging in and detecting the
+// version of the KV engine happen on first use and are retried on later uses, so an unavailable Vault does not
+// prevent starting.
+func NewClient(opts Options) (*Client, error) {
 	if opts.KVEngineName == "" {
 		return nil, errors.New("no value given for --vault-kv-engine")
 	}
 
-	if os.Getenv("VAULT_ADDR") == "" { //NOTE: VAULT_ADDR is later read by vaultapi.DefaultConfig()
+	if opts.Address == "" && os.Getenv("VAULT_ADDR") == "" { //NOTE: VAULT_ADDR is later read by vaultapi.DefaultConfig()
 		return nil, errors.New("missing required environment variable: VAULT_ADDR")
 	}
-	opts.authRoleID = os.Getenv("VAULT_ROLE_ID")
-	if opts.authRoleID == "" {
-		return nil, errors.New("missing required environment variable: VAULT_ROLE_ID")
+	if opts.Name == "" {
+		opts.Name = DefaultTarget
 	}
-	opts.authSecretID = os.Getenv("VAULT_SECRET_ID")
-	if opts.authSecretID == "" {
-		return nil, errors.New("missing required environment variable: VAULT_SECRET_ID")
+	if opts.KVVersion != 0 && opts.KVVersion != 1 && opts.KVVersion != 2 {
+		return nil, fmt.Errorf("unsupported KV engine version %d", opts.KVVersion)
 	}
-
-	client, err := vaultapi.NewClient(vaultapi.DefaultConfig())
+	if opts.Metadata == nil {
+		opts.Metadata = DefaultMetadata
+	}
+	if opts.Payload == nil {
+		opts.Payload = DefaultPayloadFields
+	}
+	if err := opts.validatePayload(); err != nil {
+		return nil, err
+	}
+	if err := opts.validateRetirePolicy(); err != nil {
+		return nil, err
+	}
+	opts.Auth.setDefaults()
+	roleID, secretID, err := opts.Auth.validate()
 	if err != nil {
 		return nil, err
 	}
 
-	// authenticate once immediately to check correctness of credentials
-	c := &Client{client: client, Options: opts, authValidUntil: time.Now().Add(-1 * time.Hour)}
-	err = c.authenticateIfNecessary()
+	config := vaultapi.DefaultConfig()
+	if opts.Address != "" {
+		config.Address = opts.Address
+	}
+	client, err := vaultapi.NewClient(config)
 	if err != nil {
 		return nil, err
 	}
-	c.Log = ctrl.Log.WithName("vaultClient").WithName("controllers").WithName("git")
-	return c, nil
-}
+	// vaultapi.NewClient sets the namespace given in VAULT_NAMESPACE.
+	if opts.Namespace != "" {
+		client.SetNamespace(opts.Namespace)
+	}
+	opts.Namespace = client.Namespace()
 
-func (c *Client) authenticateIfNecessary() error {
-	c.authMutex.Lock()
-	defer c.authMutex.Unlock()
+	auth := &authState{target: opts.Name, options: opts.Auth, roleID: roleID, secretID: secretID}
+	return &Client{
+		client:  client,
+		Options: opts,
+		Log:     ctrl.Log.WithName("vaultClient").WithName("controllers").WithName("git").WithValues("vault", opts.Name),
+		auth:    auth,
+		engines: &engineVersions{versions: make(map[string]int)},
+		managed: &managedSecrets{secrets: make(map[secretLocation]*managedSecret)},
+		values:  &readValues{secrets: make(map[secretLocation]readValue)},
+	}, nil
+}
 
-	// use existing token if possible
-	if c.authValidUntil.After(time.Now()) {
-		return nil
+// WithOptions returns a client sharing the connection and authentication of this client, but using the given options.
+func (c *Client) WithOptions(opts Options) *Client {
+	opts.Name = c.Options.Name
+	opts.Address = c.Options.Address
+	opts.Auth = c.Options.Auth
+	if opts.Namespace == "" {
+		opts.Namespace = c.Options.Namespace
+	}
+	if opts.Metadata == nil {
+		opts.Metadata = c.Options.Metadata
 	}
+	if opts.Payload == nil {
+		opts.Payload = c.Options.Payload
+	}
+	if opts.KeyNames == nil {
+		opts.KeyNames = c.Options.KeyNames
+	}
+	return &Client{client: c.client, Options: opts, Log: c.Log, auth: c.auth, engines: c.engines, managed: c.managed, values: c.values}
+}
 
-	// perform approle authentication
-	resp, err := c.client.Logical().Write("auth/approle/login", map[string]any{
-		"role_id":   c.Options.authRoleID,
-		"secret_id": c.Options.authSecretID,
-	})
-	if err != nil {
-		return fmt.Errorf("while obtaining approle token: %w", err)
+// WithNamespace returns a client sharing the connection and authentication of this client, but accessing the KV
+// engine in the given namespace. Returns this client if the namespace is empty.
+func (c *Client) WithNamespace(namespace string) *Client {
+	if namespace == "" || namespace == c.Options.Namespace {
+		return c
 	}
-	c.client.SetToken(resp.Auth.ClientToken)
-	c.authValidUntil = time.Now().Add(time.Duration(resp.Auth.LeaseDuration) * time.Second)
+	opts := c.Options
+	opts.Namespace = namespace
+	return &Client{client: c.client, Options: opts, Log: c.Log.WithValues("namespace", namespace), auth: c.auth, engines: c.engines, managed: c.managed, values: c.values}
+}
 
-	return nil
+// api returns the client for requests to the KV engine. Requests for the authentication use c.client directly,
+// as the auth method may be in another namespace.
+func (c *Client) api() *vaultapi.Client {
+	if c.Options.Namespace == c.client.Namespace() {
+		return c.client
+	}
+	// The copy uses the current token, so it must not be kept.
+	return c.client.WithNamespace(c.Options.Namespace)
 }
 
 type CertificateData struct {
 	VaultPath string
 	CertBytes []byte
 	KeyBytes  []byte
+	// Chain is the normalized chain of the certificate.
+	Chain certificate.Chain
+	// Outputs are additional outputs, e.g. the chain, by name. Written using the name as key.
+	Outputs map[string][]byte
+	// IsOutput returns whether the existing content of the output with the name holds the same as the one in Outputs,
+	// e.g. a keystore encrypted with other salts. Outputs are compared byte by byte if nil.
+	IsOutput func(name string, existing []byte) bool
+	// Metadata are templates of custom metadata overriding the ones of the options.
+	Metadata map[string]string
+	// Owners of the certificate, available in the templates of the custom metadata.
+	Owners []string
+	// Repository the certificate is configured in, see MetadataRepository.
+	Repository string
 }
 
 func (c *Client) UpdateCertificate(data CertificateData, certStatus certmanagerv1.CertificateStatus) error {
-	err := c.authenticateIfNecessary()
+	now := time.Now()
+	digest, err := c.cacheDigest(data, certStatus)
+	if err != nil {
+		return err
+	}
+	if c.isCached(data.VaultPath, digest, now) {
+		c.Log.V(1).Info("certificate in vault is up to date according to the cache", "path", data.VaultPath)
+		return nil
+	}
+
+	err = c.do(func() error {
+		return c.updateCertificate(data, certStatus)
+	})
+	if err != nil {
+		updateErrorsTotal.WithLabelValues(c.Options.Name).Inc()
+		c.invalidateCache(data.VaultPath)
+		return err
+	}
+	if c.Options.PushCertificates {
+		c.setManaged(data, certStatus, digest, now)
+	}
+	return nil
+}
+
+func (c *Client) updateCertificate(data CertificateData, certStatus certmanagerv1.CertificateStatus) error {
+	version, err := c.kvVersion()
 	if err != nil {
 		return err
 	}
 
-	fullSecretPath := c.secretPath(data.VaultPath)
-	payload := map[string]any{ // this exact type is necessary because we do reflect.DeepEqual() below!
-		"certificate": string(data.CertBytes),
-		"private-key": string(data.KeyBytes),
+	fullSecretPath := c.secretPath(data.VaultPath, version)
+	payload, err := c.payload(data) // this exact type is necessary because we do reflect.DeepEqual() below!
+	if err != nil {
+		return err
 	}
 
 	// we only want to write the secret and therefore produce a new version when actually necessary
-	secret, err := c.client.Logical().Read(fullSecretPath)
+	existing, err := c.readSecret(data.VaultPath, version)
 	if err != nil {
 		c.Log.Error(err, "failed to read secret", "path", fullSecretPath)
 		return err
 	}
+	keepExistingOutputs(existing, payload, data)
 
-	needsWrite := false
-	if secret == nil {
-		needsWrite = true // secret does not exist yet
-	} else {
-		needsWrite = !reflect.DeepEqual(secret.Data["data"], payload)
+	// the secret does not exist yet, if existing is nil
+	needsWrite := !reflect.DeepEqual(existing, payload)
+
+	// KV version 1 has no metadata
+	if version == 1 {
+		if needsWrite && c.Options.PushCertificates {
+			if err := c.writeSecret(data.VaultPath, version, payload); err != nil {
+				return fmt.Errorf("while writing payload to vault: %w", err)
+			}
+			secretsWrittenTotal.WithLabelValues(c.Options.Name).Inc()
+			return c.verifyWrite(data.VaultPath, version, payload)
+		}
+		c.Log.Info("skipping writing to vault", "path", fullSecretPath)
+		return nil
+	}
+
+	metadata, err := c.customMetadata(data, certStatus)
+	if err != nil {
+		return err
 	}
 
 	if needsWrite && c.Options.PushCertificates {
-		_, err := c.client.Logical().Write(fullSecretPath, map[string]any{"data": payload})
+		err := c.writeSecret(data.VaultPath, version, payload)
 		if err != nil {
 			return fmt.Errorf("while writing payload to vault: %w", err)
 		}
+		secretsWrittenTotal.WithLabelValues(c.Options.Name).Inc()
+		if err := c.verifyWrite(data.VaultPath, version, payload); err != nil {
+			return err
+		}
 
-		err = c.patchMetadata(data.VaultPath, certStatus)
+		err = c.patchMetadata(data.VaultPath, metadata)
 		if err != nil {
 			return fmt.Errorf("while updating metadata: %w", err)
 		}
-	} else {
-		c.Log.Info("skipping writing to vault", "path", fullSecretPath)
+		return nil
+	}
+	c.Log.Info("skipping writing to vault", "path", fullSecretPath)
+
+	if !c.Options.UpdateMetaData {
+		return nil
 	}
 
-	secretMeta, err := c.client.KVv2(c.Options.KVEngineName).GetMetadata(context.TODO(), data.VaultPath)
+	secretMeta, err := c.api().KVv2(c.Options.KVEngineName).GetMetadata(context.TODO(), data.VaultPath)
 	if err != nil {
 		c.Log.Error(err, "failed to read secret metadata", "path", fullSecretPath)
 		return err
 	}
 
-	if c.Options.UpdateMetaData && secretMeta.CustomMetadata["expiry_date"] != fmt.Sprintf("%d-%02d-%02d", certStatus.NotAfter.Year(), certStatus.NotAfter.Month(), certStatus.NotAfter.Day()) {
-		err = c.patchMetadata(data.VaultPath, certStatus)
+	// The mark of a retired certificate is removed when it is configured again.
+	_, isRetired := secretMeta.CustomMetadata[MetadataRetiredAt]
+	isMaxVersionsCurrent := c.Options.MaxVersions == 0 || secretMeta.MaxVersions == c.Options.MaxVersions
+	if !isMetadataCurrent(secretMeta.CustomMetadata, metadata) || isRetired || !isMaxVersionsCurrent {
+		err = c.patchMetadata(data.VaultPath, metadata)
 		if err != nil {
 			return fmt.Errorf("while updating metadata: %w", err)
 		}
 	} else {
-		c.Log.Info("skipping updated metadata", "path", fullSecretPath, "vaultMetaData", secretMeta.CustomMetadata, "secretMetaData", certStatus)
+		c.Log.Info("skipping updated metadata", "path", fullSecretPath, "vaultMetaData", secretMeta.CustomMetadata)
 	}
 
 	return nil
 }
 
-func (c *Client) patchMetadata(vaultPath string, certStatus certmanagerv1.CertificateStatus) error {
-	customMetadata := map[string]any{
-		"accessed_resource":       c.client.Address(),
-		"application_criticality": "high",
-		"expiry_date":             fmt.Sprintf("%d-%02d-%02d", certStatus.NotAfter.Year(), certStatus.NotAfter.Month(), certStatus.NotAfter.Day()),
-		"review_date":             fmt.Sprintf("%d-%02d-%02d", certStatus.RenewalTime.Year(), certStatus.RenewalTime.Month(), certStatus.RenewalTime.Day()),
-		"is_privileged":           "false",
-		"is_single_factor":        "false",
-		"username":                "UNLINKED",
+// ReadValue returns the value of the key in the secret at the given path of the KV engine.
+// Secrets are cached for CacheTTL.
+func (c *Client) ReadValue(vaultPath, key string) (string, error) {
+	now := time.Now()
+	secret := c.cachedSecret(vaultPath, now)
+	if secret == nil {
+		err := c.do(func() error {
+			version, err := c.kvVersion()
+			if err != nil {
+				return err
+			}
+			secret, err = c.readSecret(vaultPath, version)
+			return err
+		})
+		if err != nil {
+			return "", fmt.Errorf("while reading %s from vault: %w", vaultPath, err)
+		}
+		c.cacheSecret(vaultPath, secret, now)
 	}
-
-	err := c.client.KVv2(c.Options.KVEngineName).PatchMetadata(context.TODO(), vaultPath, vaultapi.KVMetadataPatchInput{
-		CustomMetadata: customMetadata,
-	})
-	return err
+	value, ok := secret[key].(string)
+	if !ok {
+		return "", fmt.Errorf("secret %s in vault has no key %s", vaultPath, key)
+	}
+	return value, nil
 }
 
-func (c *Client) secretPath(filePath string) string {
-	return fmt.Sprintf("%s/data/%s", c.Options.KVEngineName, filePath)
+func (c *Client) patchMetadata(vaultPath string, metadata map[string]string) error {
+	customMetadata := make(map[string]any, len(metadata)+1)
+	for key, value := range metadata {
+		customMetadata[key] = value
+	}
+	// null removes the key
+	customMetadata[MetadataRetiredAt] = nil
+
+	input := vaultapi.KVMetadataPatchInput{CustomMetadata: customMetadata}
+	if c.Options.MaxVersions > 0 {
+		input.MaxVersions = &c.Options.MaxVersions
+	}
+	return c.api().KVv2(c.Options.KVEngineName).PatchMetadata(context.TODO(), vaultPath, input)
 }
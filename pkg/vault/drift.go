@@ -0,0 +1,215 @@
+// SPDX-FileCopyrightText: 2020 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package vault
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"sync"
+	"time"
+
+	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+
+	"github.com/sapcc/git-cert-shim/pkg/certificate"
+)
+
+// managedSecrets are the secrets written by the clients sharing a connection, so they can be checked for drift and
+// unchanged certificates are not written again, see cacheDigest.
+type managedSecrets struct {
+	mtx     sync.Mutex
+	secrets map[secretLocation]*managedSecret
+}
+
+// secretLocation identifies a secret in a Vault.
+type secretLocation struct {
+	namespace string
+	engine    string
+	path      string
+}
+
+// managedSecret is what was last written to a secret.
+type managedSecret struct {
+	// client is the client the secret was written with.
+	client *Client
+	data   CertificateData
+	status certmanagerv1.CertificateStatus
+	// digest identifies the data and status, see cacheDigest.
+	digest string
+	// cachedUntil is when Vault is contacted again, even if the certificate is unchanged.
+	cachedUntil time.Time
+}
+
+func (c *Client) secretLocation(vaultPath string) secretLocation {
+	return secretLocation{namespace: c.Options.Namespace, engine: c.Options.KVEngineName, path: vaultPath}
+}
+
+// setManaged records the certificate written to the secret.
+func (c *Client) setManaged(data CertificateData, status certmanagerv1.CertificateStatus, digest string, now time.Time) {
+	loc := c.secretLocation(data.VaultPath)
+	s := &managedSecret{client: c, data: data, status: status, digest: digest}
+	if c.Options.CacheTTL > 0 {
+		s.cachedUntil = now.Add(c.Options.CacheTTL)
+	}
+	c.managed.mtx.Lock()
+	c.managed.secrets[loc] = s
+	c.managed.mtx.Unlock()
+	secretInSync.WithLabelValues(c.Options.Name, loc.namespace, loc.engine, loc.path).Set(1)
+}
+
+// unsetManaged stops checking the secret for drift.
+func (c *Client) unsetManaged(vaultPath string) {
+	loc := c.secretLocation(vaultPath)
+	c.managed.mtx.Lock()
+	delete(c.managed.secrets, loc)
+	c.managed.mtx.Unlock()
+	secretInSync.DeleteLabelValues(c.Options.Name, loc.namespace, loc.engine, loc.path)
+}
+
+// Unmanage stops checking the secret for drift, e.g. as the repository writing it is no longer handled.
+func (c *Client) Unmanage(vaultPath string) {
+	c.unsetManaged(vaultPath)
+}
+
+// certificateFingerprint returns the fingerprint of the certificate in the secret. Empty if it contains none.
+func (c *Client) certificateFingerprint(secret map[string]any) string {
+	for _, field := range []string{KeyCertificate, KeyFullChain} {
+		if !c.Options.HasField(field) {
+			continue
+		}
+		value, _ := secret[c.Options.KeyName(field)].(string) //nolint:errcheck
+		cert, err := certificate.ParseLeafCertificate([]byte(value))
+		if err != nil {
+			return ""
+		}
+		return certificate.Fingerprint(cert)
+	}
+	return ""
+}
+
+// isSecretCurrent returns whether the secret holds the certificate of the payload, compared by fingerprint.
+// Payloads without certificate are compared completely.
+func (c *Client) isSecretCurrent(secret, payload map[string]any) bool {
+	expected := c.certificateFingerprint(payload)
+	if expected == "" {
+		return reflect.DeepEqual(secret, payload)
+	}
+	return c.certificateFingerprint(secret) == expected
+}
+
+// verifyWrite reads the secret back to confirm the payload was written.
+func (c *Client) verifyWrite(vaultPath string, version int, payload map[string]any) error {
+	secret, err := c.readSecret(vaultPath, version)
+	if err != nil {
+		return fmt.Errorf("while reading back %s from vault: %w", vaultPath, err)
+	}
+	if !c.isSecretCurrent(secret, payload) {
+		return fmt.Errorf("secret %s in vault does not hold the certificate written", vaultPath)
+	}
+	return nil
+}
+
+// WatchDrift checks the secrets written for drift and repairs them every DriftCheckInterval, until the context is done.
+func (c *Client) WatchDrift(ctx context.Context) error {
+	ticker := time.NewTicker(c.Options.DriftCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			c.checkDrift()
+		}
+	}
+}
+
+// checkDrift checks all secrets written for drift and rewrites drifted ones.
+func (c *Client) checkDrift() {
+	c.managed.mtx.Lock()
+	secrets := slices.Collect(maps.Values(c.managed.secrets))
+	c.managed.mtx.Unlock()
+
+	var drifted int
+	for _, s := range secrets {
+		isCurrent, err := s.client.isCurrent(s.data)
+		if err != nil {
+			s.client.Log.Error(err, "failed to check secret for drift", "path", s.data.VaultPath)
+			s.client.invalidateCache(s.data.VaultPath)
+			continue
+		}
+		if isCurrent {
+			continue
+		}
+
+		// A certificate written meanwhile, e.g. a renewed one, must not be replaced by the one checked.
+		if !s.client.isManaged(s) {
+			continue
+		}
+		drifted++
+		s.client.invalidateCache(s.data.VaultPath)
+		loc := s.client.secretLocation(s.data.VaultPath)
+		secretInSync.WithLabelValues(s.client.Options.Name, loc.namespace, loc.engine, loc.path).Set(0)
+		s.client.Log.Info("secret does not hold the certificate written, rewriting it", "path", s.data.VaultPath)
+		if err := s.client.repair(s); err != nil {
+			s.client.Log.Error(err, "failed to repair drifted secret", "path", s.data.VaultPath)
+			continue
+		}
+		secretsRepairedTotal.WithLabelValues(s.client.Options.Name).Inc()
+	}
+	c.Log.Info("checked secrets for drift", "secrets", len(secrets), "drifted", drifted)
+}
+
+// isManaged returns whether the secret still holds the certificate last written, i.e. nothing was written since.
+func (c *Client) isManaged(s *managedSecret) bool {
+	c.managed.mtx.Lock()
+	defer c.managed.mtx.Unlock()
+	current, ok := c.managed.secrets[c.secretLocation(s.data.VaultPath)]
+	return ok && current.digest == s.digest
+}
+
+// repair rewrites the drifted secret. If another certificate was written meanwhile, it is kept as the one last
+// written, so a secret overwritten by the repair is repaired again with the next check.
+func (c *Client) repair(s *managedSecret) error {
+	err := c.do(func() error {
+		return c.updateCertificate(s.data, s.status)
+	})
+	if err != nil {
+		updateErrorsTotal.WithLabelValues(c.Options.Name).Inc()
+		return err
+	}
+
+	c.managed.mtx.Lock()
+	defer c.managed.mtx.Unlock()
+	loc := c.secretLocation(s.data.VaultPath)
+	if current, ok := c.managed.secrets[loc]; ok && current.digest == s.digest {
+		if c.Options.CacheTTL > 0 {
+			current.cachedUntil = time.Now().Add(c.Options.CacheTTL)
+		}
+		secretInSync.WithLabelValues(c.Options.Name, loc.namespace, loc.engine, loc.path).Set(1)
+	}
+	return nil
+}
+
+// isCurrent returns whether the secret holds the certificate last written.
+func (c *Client) isCurrent(data CertificateData) (bool, error) {
+	payload, err := c.payload(data)
+	if err != nil {
+		return false, err
+	}
+	var isCurrent bool
+	err = c.do(func() error {
+		version, err := c.kvVersion()
+		if err != nil {
+			return err
+		}
+		secret, err := c.readSecret(data.VaultPath, version)
+		keepExistingOutputs(secret, payload, data)
+		isCurrent = c.isSecretCurrent(secret, payload)
+		return err
+	})
+	return isCurrent, err
+}
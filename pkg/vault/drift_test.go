@@ -0,0 +1,139 @@
+// SPDX-FileCopyrightText: 2020 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package vault
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/sapcc/git-cert-shim/pkg/certificate/certtest"
+)
+
+func TestDrift(t *testing.T) {
+	vault := newFakeVault(t, nil)
+
+	// The drift checker bypasses the cache.
+	c, err := NewClientIfSelected(Options{Name: "drift", KVEngineName: "kv1", PushCertificates: true, CacheTTL: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	certByte := string(certtest.NewCertificate(t, "Test CA", 42, "a.tld"))
+	data := CertificateData{VaultPath: "certs/a", CertBytes: []byte(certByte), KeyBytes: []byte("key")}
+	if err := c.UpdateCertificate(data, certmanagerv1.CertificateStatus{}); err != nil {
+		t.Fatal(err)
+	}
+	inSync := secretInSync.WithLabelValues("drift", "", "kv1", "certs/a")
+	if testutil.ToFloat64(inSync) != 1 {
+		t.Error("expected secret in sync after writing it")
+	}
+
+	// Other values than the certificate are not compared.
+	vault.update(func() {
+		vault.secrets["kv1/certs/a"]["extra"] = "value"
+	})
+	c.checkDrift()
+	if n := vault.writes(); n != 1 {
+		t.Errorf("expected no rewrite, got %d writes", n)
+	}
+
+	other := string(certtest.NewCertificate(t, "Test CA", 42, "a.tld"))
+	vault.update(func() {
+		vault.secrets["kv1/certs/a"][KeyCertificate] = other
+	})
+	c.checkDrift()
+	if n := vault.writes(); n != 2 || vault.secret("kv1/certs/a")[KeyCertificate] != certByte {
+		t.Errorf("expected drifted secret to be rewritten, got %d writes", n)
+	}
+	if testutil.ToFloat64(inSync) != 1 || testutil.ToFloat64(secretsRepairedTotal.WithLabelValues("drift")) != 1 {
+		t.Error("expected repaired secret in sync")
+	}
+
+	// A certificate renewed after the drift check collected the secrets is not replaced by the outdated one for long.
+	c.managed.mtx.Lock()
+	outdated := c.managed.secrets[c.secretLocation("certs/a")]
+	c.managed.mtx.Unlock()
+	renewed := string(certtest.NewCertificate(t, "Test CA", 42, "a.tld"))
+	renewedData := CertificateData{VaultPath: "certs/a", CertBytes: []byte(renewed), KeyBytes: []byte("key")}
+	if err := c.UpdateCertificate(renewedData, certmanagerv1.CertificateStatus{}); err != nil {
+		t.Fatal(err)
+	}
+	if c.isManaged(outdated) {
+		t.Error("expected outdated certificate not to be managed after renewal")
+	}
+	if err := c.repair(outdated); err != nil {
+		t.Fatal(err)
+	}
+	if c.isManaged(outdated) {
+		t.Error("expected repair with outdated certificate not to replace the renewed one")
+	}
+	c.checkDrift()
+	if n := vault.writes(); n != 5 || vault.secret("kv1/certs/a")[KeyCertificate] != renewed {
+		t.Errorf("expected renewed certificate to be restored, got %d writes", n)
+	}
+
+	// Retired secrets are not checked anymore.
+	if err := c.RetireCertificate("certs/a", "repo"); err != nil {
+		t.Fatal(err)
+	}
+	vault.update(func() {
+		delete(vault.secrets, "kv1/certs/a")
+	})
+	c.checkDrift()
+	if n := vault.writes(); n != 5 {
+		t.Errorf("expected retired secret not to be rewritten, got %d writes", n)
+	}
+}
+
+func TestUnmanage(t *testing.T) {
+	vault := newFakeVault(t, nil)
+
+	c, err := NewClientIfSelected(Options{Name: "unmanage", KVEngineName: "kv1", PushCertificates: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert := certtest.NewCertificate(t, "Test CA", 42, "a.tld")
+	for _, client := range []*Client{c, c.WithNamespace("team")} {
+		if err := client.UpdateCertificate(CertificateData{VaultPath: "certs/a", CertBytes: cert, KeyBytes: []byte("key")}, certmanagerv1.CertificateStatus{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Secrets of removed repositories are left as they are.
+	c.WithNamespace("team").Unmanage("certs/a")
+	vault.update(func() {
+		delete(vault.secrets, "kv1/certs/a")
+		delete(vault.secrets, "team:kv1/certs/a")
+	})
+	c.checkDrift()
+	if vault.secret("kv1/certs/a") == nil {
+		t.Error("expected secret still managed to be repaired")
+	}
+	if vault.secret("team:kv1/certs/a") != nil {
+		t.Error("expected unmanaged secret not to be repaired")
+	}
+	if secretInSync.DeleteLabelValues("unmanage", "team", "kv1", "certs/a") {
+		t.Error("expected in sync metric of unmanaged secret to be removed")
+	}
+}
+
+func TestVerifyWrite(t *testing.T) {
+	// The Vault accepts writes, but does not store them.
+	vault := newFakeVault(t, nil)
+	vault.update(func() {
+		vault.isDiscardingWrites = true
+	})
+
+	c, err := NewClientIfSelected(Options{KVEngineName: "kv1", KVVersion: 1, PushCertificates: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := CertificateData{VaultPath: "certs/a", CertBytes: certtest.NewCertificate(t, "Test CA", 42, "a.tld"), KeyBytes: []byte("key")}
+	if err := c.UpdateCertificate(data, certmanagerv1.CertificateStatus{}); err == nil || !strings.Contains(err.Error(), "does not hold") {
+		t.Errorf("expected write not to be confirmed, got %v", err)
+	}
+}
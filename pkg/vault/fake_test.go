@@ -0,0 +1,222 @@
+// SPDX-FileCopyrightText: 2020 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package vault
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	vaultapi "github.com/hashicorp/vault/api"
+)
+
+// fakeVault serves logins with any auth method, a KV version 1 engine named kv1 and KV version 2 engines of any
+// other name, in every namespace. Secrets and metadata are stored as written and all requests are recorded.
+type fakeVault struct {
+	t   *testing.T
+	url string
+
+	mtx sync.Mutex
+	// secrets are keyed by their path, prefixed with the namespace, see fakeKey.
+	secrets  map[string]map[string]any
+	requests []fakeRequest
+	logins   int
+	// renewTTL is the TTL of renewed tokens in seconds.
+	renewTTL int
+	// revoked are the tokens denied access to secrets.
+	revoked map[string]bool
+	// isDown fails all requests as done by a sealed Vault.
+	isDown bool
+	// isDiscardingWrites accepts writes without storing them.
+	isDiscardingWrites bool
+}
+
+type fakeRequest struct {
+	method    string
+	path      string
+	namespace string
+	token     string
+	body      map[string]any
+}
+
+func (r fakeRequest) String() string {
+	return r.method + " " + r.path
+}
+
+// newFakeVault starts a fakeVault with the given secrets, used by clients created afterwards logging in via AppRole.
+func newFakeVault(t *testing.T, secrets map[string]map[string]any) *fakeVault {
+	f := &fakeVault{t: t, secrets: make(map[string]map[string]any), renewTTL: 600, revoked: make(map[string]bool)}
+	maps.Copy(f.secrets, secrets)
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	f.url = srv.URL
+	t.Setenv("VAULT_ADDR", srv.URL)
+	t.Setenv("VAULT_TOKEN", "")
+	t.Setenv("VAULT_NAMESPACE", "")
+	t.Setenv("VAULT_ROLE_ID", "role")
+	t.Setenv("VAULT_SECRET_ID", "secret")
+	// Failed requests are not retried.
+	t.Setenv("VAULT_MAX_RETRIES", "0")
+	return f
+}
+
+// fakeKey returns the key of the secret at the path in the namespace. Secrets in the root namespace are keyed by
+// their path only.
+func fakeKey(namespace, path string) string {
+	if namespace == "" {
+		return path
+	}
+	return namespace + ":" + path
+}
+
+func (f *fakeVault) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	req := fakeRequest{
+		method:    r.Method,
+		path:      strings.TrimPrefix(r.URL.Path, "/v1/"),
+		namespace: r.Header.Get(vaultapi.NamespaceHeaderName),
+		token:     r.Header.Get("X-Vault-Token"),
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		f.t.Error(err)
+	}
+	if len(body) > 0 {
+		if err := json.Unmarshal(body, &req.body); err != nil {
+			f.t.Error(err)
+		}
+	}
+	f.requests = append(f.requests, req)
+	key := fakeKey(req.namespace, req.path)
+
+	switch {
+	case f.isDown:
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(`{"errors": ["Vault is sealed"]}`)) //nolint:errcheck
+	case strings.HasPrefix(req.path, "auth/") && strings.HasSuffix(req.path, "/login"):
+		f.logins++
+		fmt.Fprintf(w, `{"auth": {"client_token": "token-%d", "lease_duration": 600, "renewable": true}}`, f.logins)
+	case req.path == "auth/token/renew-self":
+		fmt.Fprintf(w, `{"auth": {"client_token": %q, "lease_duration": %d, "renewable": true}}`, req.token, f.renewTTL)
+	case req.path == "auth/token/lookup-self":
+		w.Write([]byte(`{"data": {"ttl": 0}}`)) //nolint:errcheck
+	case f.revoked[req.token]:
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"errors": ["permission denied"]}`)) //nolint:errcheck
+	case req.path == "sys/mounts/kv1":
+		w.Write([]byte(`{"data": {"type": "kv", "options": null}}`)) //nolint:errcheck
+	case strings.HasPrefix(req.path, "sys/mounts/"):
+		w.Write([]byte(`{"data": {"type": "kv", "options": {"version": "2"}}}`)) //nolint:errcheck
+	case strings.HasPrefix(req.path, "kv1/metadata/"):
+		f.t.Errorf("unexpected request of metadata in KV version 1 engine: %s", req)
+		w.WriteHeader(http.StatusNotFound)
+	case r.Method == http.MethodGet:
+		data, ok := f.secrets[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{"data": data}) //nolint:errcheck
+	case r.Method == http.MethodDelete:
+		delete(f.secrets, key)
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPatch:
+		if !f.isDiscardingWrites {
+			f.secrets[key] = mergePatch(f.secrets[key], req.body)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		if !f.isDiscardingWrites {
+			f.secrets[key] = req.body
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// mergePatch applies the JSON merge patch as done by Vault when patching metadata.
+func mergePatch(target, patch map[string]any) map[string]any {
+	res := maps.Clone(target)
+	if res == nil {
+		res = make(map[string]any)
+	}
+	for k, v := range patch {
+		switch v := v.(type) {
+		case nil:
+			delete(res, k)
+		case map[string]any:
+			existing, _ := res[k].(map[string]any) //nolint:errcheck
+			res[k] = mergePatch(existing, v)
+		default:
+			res[k] = v
+		}
+	}
+	return res
+}
+
+// update changes the fake while it serves requests.
+func (f *fakeVault) update(fn func()) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	fn()
+}
+
+// secret returns the secret stored at the key, see fakeKey.
+func (f *fakeVault) secret(key string) map[string]any {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	return f.secrets[key]
+}
+
+// writes returns the number of secrets written, i.e. PUT and POST requests except logins.
+func (f *fakeVault) writes() int {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	var n int
+	for _, req := range f.requests {
+		if (req.method == http.MethodPut || req.method == http.MethodPost) && !strings.HasPrefix(req.path, "auth/") {
+			n++
+		}
+	}
+	return n
+}
+
+// numRequests returns the number of requests served.
+func (f *fakeVault) numRequests() int {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	return len(f.requests)
+}
+
+// requestsTo returns the requests of paths with the prefix, see fakeRequest.String.
+func (f *fakeVault) requestsTo(prefix string) []string {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	var res []string
+	for _, req := range f.requests {
+		if strings.HasPrefix(req.path, prefix) {
+			res = append(res, req.String())
+		}
+	}
+	return res
+}
+
+// lastRequest returns the last request with the given method and path, see fakeRequest.String.
+func (f *fakeVault) lastRequest(request string) (fakeRequest, bool) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	for i := len(f.requests) - 1; i >= 0; i-- {
+		if f.requests[i].String() == request {
+			return f.requests[i], true
+		}
+	}
+	return fakeRequest{}, false
+}
@@ -0,0 +1,75 @@
+// SPDX-FileCopyrightText: 2020 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package vault
+
+import (
+	"fmt"
+	"sync"
+)
+
+// engineVersions caches the detected versions of KV engines by namespace and name. Shared by all clients using the same connection.
+type engineVersions struct {
+	mtx      sync.Mutex
+	versions map[string]int
+}
+
+// kvVersion returns the version of the KV engine, as given in the options or detected from the mount of the engine.
+func (c *Client) kvVersion() (int, error) {
+	if c.Options.KVVersion != 0 {
+		return c.Options.KVVersion, nil
+	}
+
+	key := c.Options.Namespace + "/" + c.Options.KVEngineName
+	c.engines.mtx.Lock()
+	defer c.engines.mtx.Unlock()
+	if version, ok := c.engines.versions[key]; ok {
+		return version, nil
+	}
+
+	mount, err := c.api().Sys().GetMount(c.Options.KVEngineName)
+	if err != nil {
+		return 0, fmt.Errorf("while detecting the version of KV engine %s, consider --vault-kv-version: %w", c.Options.KVEngineName, err)
+	}
+	if mount.Type != "kv" && mount.Type != "generic" {
+		return 0, fmt.Errorf("engine %s is of type %s, not a KV engine", c.Options.KVEngineName, mount.Type)
+	}
+	// Mounts without a version are version 1.
+	version := 1
+	if mount.Options["version"] == "2" {
+		version = 2
+	}
+	c.engines.versions[key] = version
+	return version, nil
+}
+
+// readSecret returns the data of the secret at the path in the KV engine of the given version. Nil if it does not exist.
+func (c *Client) readSecret(filePath string, version int) (map[string]any, error) {
+	secret, err := c.api().Logical().Read(c.secretPath(filePath, version))
+	if err != nil || secret == nil {
+		return nil, err
+	}
+	if version == 1 {
+		return secret.Data, nil
+	}
+	// The data of deleted versions is nil.
+	data, _ := secret.Data["data"].(map[string]any) //nolint:errcheck
+	return data, nil
+}
+
+// writeSecret writes the data to the path in the KV engine of the given version.
+func (c *Client) writeSecret(filePath string, version int, data map[string]any) error {
+	if version == 1 {
+		_, err := c.api().Logical().Write(c.secretPath(filePath, version), data)
+		return err
+	}
+	_, err := c.api().Logical().Write(c.secretPath(filePath, version), map[string]any{"data": data})
+	return err
+}
+
+func (c *Client) secretPath(filePath string, version int) string {
+	if version == 1 {
+		return fmt.Sprintf("%s/%s", c.Options.KVEngineName, filePath)
+	}
+	return fmt.Sprintf("%s/data/%s", c.Options.KVEngineName, filePath)
+}
@@ -0,0 +1,48 @@
+// SPDX-FileCopyrightText: 2020 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package vault
+
+import (
+	"testing"
+
+	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+)
+
+func TestKVVersions(t *testing.T) {
+	vault := newFakeVault(t, map[string]map[string]any{
+		"kv2/data/keystores/a": {"data": map[string]any{"password": "v2-password"}, "metadata": map[string]any{"version": 1}},
+	})
+
+	c, err := NewClientIfSelected(Options{KVEngineName: "kv1", PushCertificates: true, UpdateMetaData: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	v2 := c.WithOptions(Options{KVEngineName: "kv2"})
+	for _, tt := range []struct {
+		client   *Client
+		expected int
+	}{{c, 1}, {v2, 2}} {
+		if version, err := tt.client.kvVersion(); err != nil || version != tt.expected {
+			t.Errorf("%s: expected version %d, got %d (%v)", tt.client.Options.KVEngineName, tt.expected, version, err)
+		}
+	}
+
+	// Secrets are written without metadata on version 1 and only when changed.
+	data := CertificateData{VaultPath: "certs/a", CertBytes: []byte("cert"), KeyBytes: []byte("key")}
+	for range 2 {
+		if err := c.UpdateCertificate(data, certmanagerv1.CertificateStatus{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := vault.writes(); n != 1 || vault.secret("kv1/certs/a")[KeyPrivateKey] != "key" {
+		t.Errorf("unexpected secret after %d writes: %v", n, vault.secret("kv1/certs/a"))
+	}
+
+	if value, err := c.ReadValue("certs/a", KeyCertificate); err != nil || value != "cert" {
+		t.Errorf("unexpected value %q (%v)", value, err)
+	}
+	if value, err := v2.ReadValue("keystores/a", "password"); err != nil || value != "v2-password" {
+		t.Errorf("unexpected value %q (%v)", value, err)
+	}
+}
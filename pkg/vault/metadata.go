@@ -0,0 +1,118 @@
+// SPDX-FileCopyrightText: 2020 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package vault
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	"gopkg.in/yaml.v3"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/sapcc/git-cert-shim/pkg/certificate"
+)
+
+// DefaultMetadata are the templates of the custom metadata written for certificates, if none are configured.
+var DefaultMetadata = map[string]string{
+	"accessed_resource":       "{{ .VaultAddress }}",
+	"application_criticality": "high",
+	"is_privileged":           "false",
+	"is_single_factor":        "false",
+	"username":                "UNLINKED",
+}
+
+const (
+	// MetadataExpiryDate is always written with the date the certificate expires.
+	MetadataExpiryDate = "expiry_date"
+	// MetadataReviewDate is always written with the date the certificate is renewed.
+	MetadataReviewDate = "review_date"
+	// MetadataRepository is written with the repository the certificate is configured in. Only secrets naming the
+	// repository are retired when the certificate is removed from it.
+	MetadataRepository = "git_cert_shim_repository"
+)
+
+// ReadMetadataFile reads the templates of the custom metadata from a YAML file mapping keys to templates.
+func ReadMetadataFile(filePath string) (map[string]string, error) {
+	fileByte, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	var metadata map[string]string
+	if err := yaml.Unmarshal(fileByte, &metadata); err != nil {
+		return nil, err
+	}
+	if metadata == nil {
+		metadata = map[string]string{}
+	}
+	return metadata, certificate.ValidateMetadataTemplates(metadata)
+}
+
+// MetadataData is passed to the templates of the custom metadata.
+type MetadataData struct {
+	CommonName   string
+	SANs         []string
+	Owners       []string
+	SerialNumber string
+	NotBefore    time.Time
+	NotAfter     time.Time
+	// Issuer is the distinguished name of the issuer of the certificate.
+	Issuer string
+	// ExpiryDate and ReviewDate are formatted like 2006-01-02.
+	ExpiryDate   string
+	ReviewDate   string
+	VaultAddress string
+	VaultPath    string
+}
+
+// customMetadata renders the custom metadata of the certificate.
+func (c *Client) customMetadata(data CertificateData, certStatus certmanagerv1.CertificateStatus) (map[string]string, error) {
+	cert, err := certificate.ParseLeafCertificate(data.CertBytes)
+	if err != nil {
+		return nil, err
+	}
+	tplData := MetadataData{
+		CommonName:   cert.Subject.CommonName,
+		SANs:         cert.DNSNames,
+		Owners:       data.Owners,
+		SerialNumber: certificate.FormatSerialNumber(cert),
+		NotBefore:    cert.NotBefore,
+		NotAfter:     cert.NotAfter,
+		Issuer:       cert.Issuer.String(),
+		ExpiryDate:   formatDate(certStatus.NotAfter),
+		ReviewDate:   formatDate(certStatus.RenewalTime),
+		VaultAddress: c.client.Address(),
+		VaultPath:    data.VaultPath,
+	}
+
+	metadata, err := certificate.RenderMetadata(certificate.MergeMetadataTemplates(c.Options.Metadata, data.Metadata), tplData)
+	if err != nil {
+		return nil, fmt.Errorf("certificate %s: %w", tplData.CommonName, err)
+	}
+	metadata[MetadataExpiryDate] = tplData.ExpiryDate
+	metadata[MetadataReviewDate] = tplData.ReviewDate
+	if data.Repository != "" {
+		metadata[MetadataRepository] = data.Repository
+	}
+	return metadata, nil
+}
+
+// isMetadataCurrent returns whether the existing custom metadata contain the given one.
+func isMetadataCurrent(existing map[string]any, metadata map[string]string) bool {
+	for key, value := range metadata {
+		if v, ok := existing[key].(string); !ok || v != value {
+			return false
+		}
+	}
+	return true
+}
+
+// formatDate formats the time as date. Empty if not given.
+func formatDate(t *metav1.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format(time.DateOnly)
+}
@@ -0,0 +1,77 @@
+// SPDX-FileCopyrightText: 2020 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package vault
+
+import (
+	"maps"
+	"testing"
+	"time"
+
+	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	vaultapi "github.com/hashicorp/vault/api"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/sapcc/git-cert-shim/pkg/certificate/certtest"
+)
+
+func TestCustomMetadata(t *testing.T) {
+	client, err := vaultapi.NewClient(&vaultapi.Config{Address: "https://vault.example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &Client{client: client, Options: Options{Metadata: DefaultMetadata}}
+
+	notAfter := metav1.NewTime(time.Date(2027, 3, 4, 5, 6, 7, 0, time.UTC))
+	renewal := metav1.NewTime(time.Date(2027, 2, 2, 5, 6, 7, 0, time.UTC))
+	status := certmanagerv1.CertificateStatus{NotAfter: &notAfter, RenewalTime: &renewal}
+	data := CertificateData{
+		VaultPath: "team/a.tld",
+		CertBytes: certtest.NewCertificate(t, "Test CA", 42, "a.tld"),
+		Metadata: map[string]string{
+			"application_criticality": "low",
+			"username":                "",
+			"owners":                  `{{ join .Owners "," }}`,
+			"serial":                  "{{ .SerialNumber }}",
+			"expiry_date":             "overridden",
+		},
+		Owners:     []string{"team-a", "team-b"},
+		Repository: "repo",
+	}
+
+	metadata, err := c.customMetadata(data, status)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{
+		"accessed_resource":       "https://vault.example.com",
+		"application_criticality": "low",
+		"is_privileged":           "false",
+		"is_single_factor":        "false",
+		"owners":                  "team-a,team-b",
+		"serial":                  "2a",
+		"expiry_date":             "2027-03-04",
+		"review_date":             "2027-02-02",
+		MetadataRepository:        "repo",
+	}
+	if !maps.Equal(metadata, expected) {
+		t.Errorf("unexpected metadata %v", metadata)
+	}
+
+	existing := map[string]any{"other": "value"}
+	for k, v := range expected {
+		existing[k] = v
+	}
+	if !isMetadataCurrent(existing, metadata) {
+		t.Error("expected metadata to be current")
+	}
+	existing["expiry_date"] = "2026-03-04"
+	if isMetadataCurrent(existing, metadata) {
+		t.Error("expected metadata not to be current")
+	}
+
+	data.Metadata = map[string]string{"missing": "{{ .Missing }}"}
+	if _, err := c.customMetadata(data, status); err == nil {
+		t.Error("expected error for unknown field")
+	}
+}
@@ -0,0 +1,66 @@
+// SPDX-FileCopyrightText: 2020 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package vault
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+func init() {
+	metrics.Registry.MustRegister(tokenTTLSeconds, secretsWrittenTotal, updateErrorsTotal, secretsRetiredTotal, secretInSync, secretsRepairedTotal, vaultUp)
+}
+
+const metricNamespace = "git_cert_shim"
+
+var (
+	tokenTTLSeconds = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricNamespace,
+		Subsystem: "vault",
+		Name:      "token_ttl_seconds",
+		Help:      "TTL of the Vault token when it was obtained or last renewed. Zero if the token does not expire.",
+	}, []string{"vault"})
+
+	secretsWrittenTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricNamespace,
+		Subsystem: "vault",
+		Name:      "secrets_written_total",
+		Help:      "Counter for certificates written to Vault",
+	}, []string{"vault"})
+
+	updateErrorsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricNamespace,
+		Subsystem: "vault",
+		Name:      "update_errors_total",
+		Help:      "Counter for errors while updating certificates in Vault",
+	}, []string{"vault"})
+
+	secretsRetiredTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricNamespace,
+		Subsystem: "vault",
+		Name:      "secrets_retired_total",
+		Help:      "Counter for secrets of certificates retired in Vault after being removed from the configuration",
+	}, []string{"vault"})
+
+	secretInSync = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricNamespace,
+		Subsystem: "vault",
+		Name:      "secret_in_sync",
+		Help:      "Whether the secret in Vault holds the certificate last written. Zero while drifted secrets are not repaired.",
+	}, []string{"vault", "namespace", "engine", "path"})
+
+	secretsRepairedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricNamespace,
+		Subsystem: "vault",
+		Name:      "secrets_repaired_total",
+		Help:      "Counter for secrets rewritten after no longer holding the certificate written",
+	}, []string{"vault"})
+
+	vaultUp = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricNamespace,
+		Subsystem: "vault",
+		Name:      "up",
+		Help:      "Whether Vault was reachable and accepted the credentials on the last request. Certificates are written again once it is available.",
+	}, []string{"vault"})
+)
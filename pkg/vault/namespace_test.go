@@ -0,0 +1,59 @@
+// SPDX-FileCopyrightText: 2020 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package vault
+
+import (
+	"testing"
+
+	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+
+	"github.com/sapcc/git-cert-shim/pkg/certificate/certtest"
+)
+
+func TestNamespaces(t *testing.T) {
+	vault := newFakeVault(t, map[string]map[string]any{
+		"admin/team-a:secrets/data/keystores/a": {"data": map[string]any{"password": "team-a-password"}},
+	})
+
+	c, err := NewClientIfSelected(Options{Namespace: "admin", KVEngineName: "secrets", PushCertificates: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.WithNamespace("") != c || c.WithNamespace("admin") != c {
+		t.Error("expected the same client for the namespace of the client")
+	}
+	team := c.WithNamespace("admin/team-a")
+
+	data := CertificateData{VaultPath: "certs/a", CertBytes: certtest.NewCertificate(t, "Test CA", 42, "a.tld"), KeyBytes: []byte("key")}
+	if err := team.UpdateCertificate(data, certmanagerv1.CertificateStatus{}); err != nil {
+		t.Fatal(err)
+	}
+	if value, err := team.ReadValue("keystores/a", "password"); err != nil || value != "team-a-password" {
+		t.Errorf("unexpected value %q (%v)", value, err)
+	}
+	if err := c.UpdateCertificate(data, certmanagerv1.CertificateStatus{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The engine is detected per namespace, while logging in uses the namespace of the client.
+	expected := map[string]string{
+		"PUT auth/approle/login":         "admin",
+		"GET sys/mounts/secrets":         "admin/team-a",
+		"GET secrets/data/certs/a":       "admin",
+		"PUT secrets/data/certs/a":       "admin",
+		"PATCH secrets/metadata/certs/a": "admin",
+		"GET secrets/data/keystores/a":   "admin/team-a",
+	}
+	for request, namespace := range expected {
+		if req, _ := vault.lastRequest(request); req.namespace != namespace {
+			t.Errorf("%s: expected namespace %q, got %q", request, namespace, req.namespace)
+		}
+	}
+	if vault.secret("admin/team-a:secrets/data/certs/a") == nil {
+		t.Error("certificate not written to namespace admin/team-a")
+	}
+	if vault.secret("admin/team-a:secrets/metadata/certs/a") == nil {
+		t.Error("metadata not written to namespace admin/team-a")
+	}
+}
@@ -0,0 +1,155 @@
+// SPDX-FileCopyrightText: 2020 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package vault
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/sapcc/git-cert-shim/pkg/certificate"
+)
+
+// Fields of the payload written for a certificate. Also the default names of the keys in the secret.
+const (
+	// KeyCertificate is the key of the certificate in the secret.
+	KeyCertificate = "certificate"
+	// KeyPrivateKey is the key of the private key in the secret.
+	KeyPrivateKey = "private-key"
+	// KeyCA is the root CA.
+	KeyCA = "ca"
+	// KeyFullChain is the certificate followed by the intermediate CAs.
+	KeyFullChain = "fullchain"
+	// KeySerialNumber is the serial number formatted as colon separated hex bytes.
+	KeySerialNumber = "serial-number"
+	// KeyNotBefore and KeyNotAfter are formatted as RFC 3339 in UTC.
+	KeyNotBefore = "not-before"
+	KeyNotAfter  = "not-after"
+	// KeySANs are the comma separated DNS names.
+	KeySANs = "sans"
+	// KeyIssuer is the distinguished name of the issuer.
+	KeyIssuer = "issuer"
+)
+
+// PayloadFields are all fields available in the payload.
+var PayloadFields = []string{KeyCertificate, KeyPrivateKey, KeyCA, KeyFullChain, KeySerialNumber, KeyNotBefore, KeyNotAfter, KeySANs, KeyIssuer}
+
+// DefaultPayloadFields are written if no fields are configured.
+var DefaultPayloadFields = []string{KeyCertificate, KeyPrivateKey}
+
+// validatePayload checks the configured fields and names of keys.
+func (o *Options) validatePayload() error {
+	seen := make(map[string]string, len(o.Payload))
+	for _, field := range o.Payload {
+		if !slices.Contains(PayloadFields, field) {
+			return fmt.Errorf("unknown payload field %q, must be one of %s", field, strings.Join(PayloadFields, ", "))
+		}
+		name := o.KeyName(field)
+		if name == "" {
+			return fmt.Errorf("empty key name for payload field %s", field)
+		}
+		if other, ok := seen[name]; ok {
+			return fmt.Errorf("payload fields %s and %s use the same key %s", other, field, name)
+		}
+		seen[name] = field
+	}
+	for field := range o.KeyNames {
+		if !slices.Contains(PayloadFields, field) {
+			return fmt.Errorf("unknown payload field %q, must be one of %s", field, strings.Join(PayloadFields, ", "))
+		}
+	}
+	return nil
+}
+
+// CheckOutputs checks that none of the outputs with the given names, e.g. the chain or a keystore, is written to the
+// key of another payload field. The payload fields ca and fullchain hold the same as the outputs of the same name.
+func (o Options) CheckOutputs(names []string) error {
+	for _, field := range o.Payload {
+		name := o.KeyName(field)
+		if name != field && slices.Contains(names, name) {
+			return fmt.Errorf("payload field %s and output %s use the same key %s", field, name, name)
+		}
+	}
+	return nil
+}
+
+// KeyName returns the name of the key the field is written to.
+func (o Options) KeyName(field string) string {
+	if name, ok := o.KeyNames[field]; ok {
+		return name
+	}
+	return field
+}
+
+// HasField returns whether the field is written to Vault.
+func (o Options) HasField(field string) bool {
+	return slices.Contains(o.Payload, field)
+}
+
+// payload returns the secret written for the certificate. All values are strings, so it can be compared to the
+// secret read from Vault.
+func (c *Client) payload(data CertificateData) (map[string]any, error) {
+	if err := c.Options.CheckOutputs(slices.Collect(maps.Keys(data.Outputs))); err != nil {
+		return nil, err
+	}
+	payload := make(map[string]any, len(c.Options.Payload)+len(data.Outputs))
+	for name, content := range data.Outputs {
+		payload[name] = string(content)
+	}
+
+	needsFacts := slices.ContainsFunc(c.Options.Payload, func(field string) bool {
+		return field != KeyCertificate && field != KeyPrivateKey && field != KeyCA && field != KeyFullChain
+	})
+	var facts map[string]string
+	if needsFacts {
+		cert, err := certificate.ParseLeafCertificate(data.CertBytes)
+		if err != nil {
+			return nil, err
+		}
+		facts = map[string]string{
+			KeySerialNumber: certificate.FormatSerialNumber(cert),
+			KeyNotBefore:    cert.NotBefore.UTC().Format(time.RFC3339),
+			KeyNotAfter:     cert.NotAfter.UTC().Format(time.RFC3339),
+			KeySANs:         strings.Join(cert.DNSNames, ","),
+			KeyIssuer:       cert.Issuer.String(),
+		}
+	}
+
+	for _, field := range c.Options.Payload {
+		var value string
+		switch field {
+		case KeyCertificate:
+			value = string(data.CertBytes)
+		case KeyPrivateKey:
+			value = string(data.KeyBytes)
+		case KeyCA:
+			value = string(data.Chain.CA)
+		case KeyFullChain:
+			value = string(data.Chain.FullChain)
+		default:
+			value = facts[field]
+		}
+		// Unavailable fields, e.g. the CA, are omitted.
+		if value != "" {
+			payload[c.Options.KeyName(field)] = value
+		}
+	}
+	return payload, nil
+}
+
+// keepExistingOutputs replaces the outputs in the payload by the existing ones holding the same, so outputs encoded
+// with random salts are not written again.
+func keepExistingOutputs(existing, payload map[string]any, data CertificateData) {
+	if data.IsOutput == nil {
+		return
+	}
+	for name := range data.Outputs {
+		value, ok := existing[name].(string)
+		if ok && value != payload[name] && data.IsOutput(name, []byte(value)) {
+			payload[name] = value
+		}
+	}
+}
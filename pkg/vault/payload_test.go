@@ -0,0 +1,99 @@
+// SPDX-FileCopyrightText: 2020 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package vault
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/sapcc/git-cert-shim/pkg/certificate"
+	"github.com/sapcc/git-cert-shim/pkg/certificate/certtest"
+)
+
+func TestPayload(t *testing.T) {
+	certByte := certtest.NewCertificate(t, "Test CA", 42, "a.tld")
+	opts := Options{
+		Payload:  PayloadFields,
+		KeyNames: map[string]string{KeyCertificate: "tls.crt", KeyPrivateKey: "tls.key"},
+	}
+	if err := opts.validatePayload(); err != nil {
+		t.Fatal(err)
+	}
+	c := &Client{Options: opts}
+
+	data := CertificateData{
+		CertBytes: certByte,
+		KeyBytes:  []byte("key"),
+		Chain:     certificate.Chain{FullChain: certByte},
+		Outputs:   map[string][]byte{"der": []byte("ZGVy")},
+	}
+	payload, err := c.payload(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]any{
+		"tls.crt":       string(certByte),
+		"tls.key":       "key",
+		"fullchain":     string(certByte),
+		"serial-number": "2a",
+		"not-before":    payload["not-before"],
+		"not-after":     payload["not-after"],
+		"sans":          "a.tld",
+		"issuer":        "CN=Test CA",
+		"der":           "ZGVy",
+	}
+	if !reflect.DeepEqual(payload, expected) {
+		t.Errorf("unexpected payload %v", payload)
+	}
+
+	// The payload must equal the secret read back from Vault, otherwise it is written every time.
+	b, err := json.Marshal(map[string]any{"data": payload})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var secret struct {
+		Data map[string]any `json:"data"`
+	}
+	if err := json.Unmarshal(b, &secret); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(secret.Data, payload) {
+		t.Error("expected payload to equal the secret read back")
+	}
+
+	// Outputs holding the same, e.g. encoded with other salts, are kept.
+	data.IsOutput = func(name string, existing []byte) bool { return name == "der" && string(existing) == "ZGVyIGFnYWlu" }
+	existing := map[string]any{"der": "ZGVyIGFnYWlu", "tls.key": "other"}
+	keepExistingOutputs(existing, payload, data)
+	if payload["der"] != "ZGVyIGFnYWlu" || payload["tls.key"] != "key" {
+		t.Errorf("expected only the existing output to be kept, got %v", payload)
+	}
+
+	for _, invalid := range []Options{
+		{Payload: []string{"unknown"}},
+		{Payload: []string{KeyCertificate, KeyCA}, KeyNames: map[string]string{KeyCertificate: "ca"}},
+		{Payload: []string{KeyCertificate}, KeyNames: map[string]string{"unknown": "x"}},
+		{Payload: []string{KeyCertificate}, KeyNames: map[string]string{KeyCertificate: ""}},
+	} {
+		if err := invalid.validatePayload(); err == nil {
+			t.Errorf("expected error for %+v", invalid)
+		}
+	}
+
+	// Outputs must not replace other payload fields. The CA and full chain hold the same as the outputs of the same name.
+	if err := opts.CheckOutputs([]string{"ca", "fullchain", "der"}); err != nil {
+		t.Error(err)
+	}
+	renamed := Options{Payload: []string{KeyCertificate, KeyFullChain}, KeyNames: map[string]string{KeyCertificate: "der", KeyFullChain: "chain"}}
+	for _, output := range []string{"der", "chain"} {
+		if err := renamed.CheckOutputs([]string{output}); err == nil {
+			t.Errorf("expected error for output %s", output)
+		}
+	}
+	data.Outputs = map[string][]byte{"der": []byte("ZGVy")}
+	if _, err := (&Client{Options: renamed}).payload(data); err == nil {
+		t.Error("expected error writing an output to the key of a payload field")
+	}
+}
@@ -0,0 +1,122 @@
+// SPDX-FileCopyrightText: 2020 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package vault
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	vaultapi "github.com/hashicorp/vault/api"
+)
+
+// Policies for the secrets of certificates that are no longer configured.
+const (
+	// RetireKeep leaves the secret as is. The default.
+	RetireKeep = "keep"
+	// RetireMark sets MetadataRetiredAt in the custom metadata.
+	RetireMark = "mark"
+	// RetireDelete soft-deletes the latest version, which can be undeleted.
+	RetireDelete = "delete"
+	// RetireDestroy permanently destroys the latest version.
+	RetireDestroy = "destroy"
+	// RetireDeleteMetadata deletes the metadata and all versions.
+	RetireDeleteMetadata = "delete-metadata"
+)
+
+// RetirePolicies are all policies for the secrets of certificates that are no longer configured.
+var RetirePolicies = []string{RetireKeep, RetireMark, RetireDelete, RetireDestroy, RetireDeleteMetadata}
+
+// MetadataRetiredAt is the key of the custom metadata marking secrets with RetireMark. Formatted as RFC 3339.
+const MetadataRetiredAt = "retired_at"
+
+func (o *Options) validateRetirePolicy() error {
+	if o.RetirePolicy != "" && !slices.Contains(RetirePolicies, o.RetirePolicy) {
+		return fmt.Errorf("unknown retire policy %q, must be one of %s", o.RetirePolicy, strings.Join(RetirePolicies, ", "))
+	}
+	if o.MaxVersions < 0 {
+		return fmt.Errorf("invalid max versions %d", o.MaxVersions)
+	}
+	return nil
+}
+
+// RetireCertificate applies the retire policy to the secret at the given path, after the certificate was removed
+// from the configuration of the repository. Only secrets whose custom metadata name the repository as the one
+// writing them are retired, see MetadataRepository.
+func (c *Client) RetireCertificate(vaultPath, repository string) error {
+	c.unsetManaged(vaultPath)
+	if !c.Options.PushCertificates || c.Options.RetirePolicy == "" || c.Options.RetirePolicy == RetireKeep {
+		return nil
+	}
+	var isRetired bool
+	err := c.do(func() error {
+		var err error
+		isRetired, err = c.retireCertificate(vaultPath, repository, time.Now())
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("while retiring %s in vault: %w", vaultPath, err)
+	}
+	if isRetired {
+		c.Log.Info("retired certificate", "path", vaultPath, "policy", c.Options.RetirePolicy)
+		secretsRetiredTotal.WithLabelValues(c.Options.Name).Inc()
+	}
+	return nil
+}
+
+// retireCertificate returns whether the secret was retired.
+func (c *Client) retireCertificate(vaultPath, repository string, now time.Time) (bool, error) {
+	version, err := c.kvVersion()
+	if err != nil {
+		return false, err
+	}
+
+	// KV version 1 has neither metadata nor versions, so it cannot be told who wrote the secret.
+	if version == 1 {
+		c.Log.Info("not retiring secret in KV version 1 engine, as it has no metadata naming the repository writing it", "path", vaultPath)
+		return false, nil
+	}
+
+	kv := c.api().KVv2(c.Options.KVEngineName)
+	metadata, err := kv.GetMetadata(context.TODO(), vaultPath)
+	switch {
+	case isNotFound(err):
+		// Secrets deleted in the meantime are fine.
+		return false, nil
+	case err != nil:
+		return false, err
+	}
+	if owner, _ := metadata.CustomMetadata[MetadataRepository].(string); owner != repository { //nolint:errcheck
+		c.Log.Info("not retiring secret written by another repository or by someone else", "path", vaultPath, "writtenBy", owner)
+		return false, nil
+	}
+
+	switch c.Options.RetirePolicy {
+	case RetireMark:
+		err = kv.PatchMetadata(context.TODO(), vaultPath, vaultapi.KVMetadataPatchInput{
+			CustomMetadata: map[string]any{MetadataRetiredAt: now.UTC().Format(time.RFC3339)},
+		})
+	case RetireDelete:
+		err = kv.Delete(context.TODO(), vaultPath)
+	case RetireDestroy:
+		if metadata.CurrentVersion > 0 {
+			err = kv.Destroy(context.TODO(), vaultPath, []int{metadata.CurrentVersion})
+		}
+	case RetireDeleteMetadata:
+		err = kv.DeleteMetadata(context.TODO(), vaultPath)
+	}
+	if isNotFound(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func isNotFound(err error) bool {
+	var respErr *vaultapi.ResponseError
+	return errors.Is(err, vaultapi.ErrSecretNotFound) || errors.As(err, &respErr) && respErr.StatusCode == http.StatusNotFound
+}
@@ -0,0 +1,91 @@
+// SPDX-FileCopyrightText: 2020 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package vault
+
+import (
+	"slices"
+	"testing"
+)
+
+// retireSecrets are the metadata of secrets written by the repository repo, except for those below foreign/.
+var retireSecrets = map[string]map[string]any{
+	"kv2/metadata/a":         {"current_version": 3, "custom_metadata": map[string]any{MetadataRepository: "repo"}},
+	"kv2/metadata/foreign/a": {"current_version": 1, "custom_metadata": map[string]any{MetadataRepository: "other"}},
+}
+
+func TestRetireCertificate(t *testing.T) {
+	tests := []struct {
+		engine   string
+		policy   string
+		path     string
+		expected []string
+	}{
+		{"kv2", RetireKeep, "a", nil},
+		{"kv2", RetireMark, "a", []string{"GET kv2/metadata/a", "PATCH kv2/metadata/a"}},
+		{"kv2", RetireDelete, "a", []string{"GET kv2/metadata/a", "DELETE kv2/data/a"}},
+		{"kv2", RetireDestroy, "a", []string{"GET kv2/metadata/a", "PUT kv2/destroy/a"}},
+		{"kv2", RetireDestroy, "missing", []string{"GET kv2/metadata/missing"}},
+		{"kv2", RetireDeleteMetadata, "a", []string{"GET kv2/metadata/a", "DELETE kv2/metadata/a"}},
+		{"kv2", RetireDeleteMetadata, "foreign/a", []string{"GET kv2/metadata/foreign/a"}},
+		// Version 1 engines have no metadata naming the repository.
+		{"kv1", RetireDelete, "a", nil},
+		{"kv1", RetireMark, "a", nil},
+	}
+	for _, tt := range tests {
+		vault := newFakeVault(t, retireSecrets)
+		c, err := NewClientIfSelected(Options{KVEngineName: tt.engine, PushCertificates: true, RetirePolicy: tt.policy})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := c.RetireCertificate(tt.path, "repo"); err != nil {
+			t.Errorf("%s %s: %v", tt.engine, tt.policy, err)
+		}
+		if requests := vault.requestsTo(tt.engine + "/"); !slices.Equal(requests, tt.expected) {
+			t.Errorf("%s %s: expected requests %v, got %v", tt.engine, tt.policy, tt.expected, requests)
+		}
+
+		switch tt.policy {
+		case RetireMark:
+			if tt.engine == "kv1" {
+				continue
+			}
+			req, _ := vault.lastRequest("PATCH kv2/metadata/a")
+			metadata, _ := req.body["custom_metadata"].(map[string]any) //nolint:errcheck
+			if _, ok := metadata[MetadataRetiredAt].(string); !ok {
+				t.Errorf("expected %s in %v", MetadataRetiredAt, metadata)
+			}
+		case RetireDestroy:
+			if req, ok := vault.lastRequest("PUT kv2/destroy/a"); tt.path == "a" && (!ok || !slices.Equal(req.body["versions"].([]any), []any{float64(3)})) {
+				t.Errorf("unexpected versions destroyed: %v", req.body)
+			}
+		}
+	}
+
+	if _, err := NewClientIfSelected(Options{KVEngineName: "kv2", RetirePolicy: "shred"}); err == nil {
+		t.Error("expected error for unknown retire policy")
+	}
+}
+
+func TestPatchMetadata(t *testing.T) {
+	vault := newFakeVault(t, nil)
+
+	c, err := NewClientIfSelected(Options{KVEngineName: "kv2", PushCertificates: true, MaxVersions: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.patchMetadata("a", map[string]string{"team": "a"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The mark of retired certificates is removed when written again.
+	req, _ := vault.lastRequest("PATCH kv2/metadata/a")
+	body := req.body
+	metadata, _ := body["custom_metadata"].(map[string]any) //nolint:errcheck
+	if value, ok := metadata[MetadataRetiredAt]; !ok || value != nil || metadata["team"] != "a" {
+		t.Errorf("unexpected custom metadata %v", metadata)
+	}
+	if body["max_versions"] != float64(5) {
+		t.Errorf("unexpected max versions %v", body["max_versions"])
+	}
+}
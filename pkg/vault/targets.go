@@ -0,0 +1,99 @@
+// SPDX-FileCopyrightText: 2020 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package vault
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// targetConfig is a Vault certificates are replicated to.
+type targetConfig struct {
+	Name      string `yaml:"name"`
+	Address   string `yaml:"address"`
+	Namespace string `yaml:"namespace"`
+	KVEngine  string `yaml:"kvEngine"`
+	KVVersion int    `yaml:"kvVersion"`
+	Auth      struct {
+		Method    string `yaml:"method"`
+		Mount     string `yaml:"mount"`
+		Role      string `yaml:"role"`
+		TokenFile string `yaml:"tokenFile"`
+	} `yaml:"auth"`
+}
+
+// ReadTargetsFile reads the additional Vaults certificates are written to. Settings not specific to a Vault,
+// e.g. the payload, are taken from the given defaults.
+func ReadTargetsFile(filePath string, defaults Options) ([]Options, error) {
+	fileByte, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	var cfg struct {
+		Targets []targetConfig `yaml:"targets"`
+	}
+	if err := yaml.Unmarshal(fileByte, &cfg); err != nil {
+		return nil, err
+	}
+
+	res := make([]Options, 0, len(cfg.Targets))
+	seen := map[string]bool{DefaultTarget: true}
+	for _, t := range cfg.Targets {
+		switch {
+		case t.Name == "":
+			return nil, errors.New("vault target without name")
+		case seen[t.Name]:
+			return nil, fmt.Errorf("vault target %s defined more than once", t.Name)
+		case t.Address == "":
+			return nil, fmt.Errorf("vault target %s: address missing", t.Name)
+		}
+		seen[t.Name] = true
+
+		opts := defaults
+		opts.Name = t.Name
+		opts.Address = t.Address
+		opts.KVVersion = t.KVVersion
+		if t.Namespace != "" {
+			opts.Namespace = t.Namespace
+		}
+		if t.KVEngine != "" {
+			opts.KVEngineName = t.KVEngine
+		}
+		opts.Auth = AuthOptions{
+			Method:       t.Auth.Method,
+			Mount:        t.Auth.Mount,
+			Role:         t.Auth.Role,
+			TokenFile:    t.Auth.TokenFile,
+			EnvVarPrefix: targetEnvVarPrefix(t.Name),
+		}
+		res = append(res, opts)
+	}
+	return res, nil
+}
+
+// WithRepositoryOptions returns a client of the target using the Vault options of a repository, which are based on the
+// given defaults of the controller. The namespace, KV engine and KV version of the target are kept unless the
+// repository changes them.
+func (c *Client) WithRepositoryOptions(opts, defaults Options) *Client {
+	if opts.Namespace == defaults.Namespace {
+		opts.Namespace = c.Options.Namespace
+	}
+	if opts.KVEngineName == defaults.KVEngineName {
+		opts.KVEngineName = c.Options.KVEngineName
+		if opts.KVVersion == defaults.KVVersion {
+			opts.KVVersion = c.Options.KVVersion
+		}
+	}
+	return c.WithOptions(opts)
+}
+
+// targetEnvVarPrefix returns the prefix of the environment variables of the named Vault, e.g. VAULT_EU_DE_1.
+func targetEnvVarPrefix(name string) string {
+	return "VAULT_" + strings.ToUpper(strings.NewReplacer("-", "_", ".", "_").Replace(name))
+}
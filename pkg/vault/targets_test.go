@@ -0,0 +1,105 @@
+// SPDX-FileCopyrightText: 2020 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package vault
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadTargetsFile(t *testing.T) {
+	defaults := Options{PushCertificates: true, KVEngineName: "secrets", KVVersion: 2, Payload: []string{KeyCertificate}}
+	write := func(content string) string {
+		filePath := filepath.Join(t.TempDir(), "targets.yaml")
+		if err := os.WriteFile(filePath, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return filePath
+	}
+
+	targets, err := ReadTargetsFile(write(`
+targets:
+  - name: eu-de-1
+    address: https://vault.eu-de-1.tld
+    kvEngine: certs
+    auth:
+      method: kubernetes
+      role: git-cert-shim
+  - name: na-us-1
+    address: https://vault.na-us-1.tld
+    kvVersion: 1
+`), defaults)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(targets) != 2 {
+		t.Fatalf("expected 2 targets, got %d", len(targets))
+	}
+	eu, na := targets[0], targets[1]
+	if eu.Name != "eu-de-1" || eu.Address != "https://vault.eu-de-1.tld" || eu.KVEngineName != "certs" || eu.KVVersion != 0 {
+		t.Errorf("unexpected options %+v", eu)
+	}
+	if eu.Auth.Method != AuthKubernetes || eu.Auth.Role != "git-cert-shim" || eu.Auth.EnvVarPrefix != "VAULT_EU_DE_1" {
+		t.Errorf("unexpected auth options %+v", eu.Auth)
+	}
+	if na.KVEngineName != "secrets" || na.KVVersion != 1 || !na.PushCertificates || !na.HasField(KeyCertificate) {
+		t.Errorf("defaults not applied: %+v", na)
+	}
+
+	invalid := map[string]string{
+		"without name":   "targets:\n  - address: https://vault.tld\n",
+		"default name":   "targets:\n  - name: default\n    address: https://vault.tld\n",
+		"duplicate name": "targets:\n  - name: a\n    address: https://a.tld\n  - name: a\n    address: https://b.tld\n",
+		"no address":     "targets:\n  - name: a\n",
+	}
+	for name, content := range invalid {
+		if _, err := ReadTargetsFile(write(content), defaults); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestTargetCredentialsFromEnv(t *testing.T) {
+	t.Setenv("VAULT_EU_DE_1_ROLE_ID", "role")
+	t.Setenv("VAULT_EU_DE_1_SECRET_ID", "secret")
+
+	opts := AuthOptions{EnvVarPrefix: targetEnvVarPrefix("eu-de.1")}
+	opts.setDefaults()
+	roleID, secretID, err := opts.validate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if roleID != "role" || secretID != "secret" {
+		t.Errorf("unexpected credentials %q, %q", roleID, secretID)
+	}
+
+	opts = AuthOptions{EnvVarPrefix: targetEnvVarPrefix("na-us-1")}
+	opts.setDefaults()
+	if _, _, err := opts.validate(); err == nil || !strings.Contains(err.Error(), "VAULT_NA_US_1_ROLE_ID") {
+		t.Errorf("expected error naming the missing variable, got %v", err)
+	}
+}
+
+func TestWithRepositoryOptions(t *testing.T) {
+	defaults := Options{PushCertificates: true, Namespace: "team", KVEngineName: "secrets", KVVersion: 1}
+	target := &Client{Options: Options{Name: "eu-de-1", Namespace: "admin", KVEngineName: "certs", KVVersion: 2}}
+
+	// Settings of the repository equal to the defaults do not override the ones of the target.
+	repo := defaults
+	repo.UpdateMetaData = true
+	c := target.WithRepositoryOptions(repo, defaults)
+	if c.Options.Namespace != "admin" || c.Options.KVEngineName != "certs" || c.Options.KVVersion != 2 || !c.Options.UpdateMetaData {
+		t.Errorf("expected settings of the target, got %+v", c.Options)
+	}
+
+	repo.Namespace = "team-a"
+	repo.KVEngineName = "team-a"
+	repo.KVVersion = 0
+	c = target.WithRepositoryOptions(repo, defaults)
+	if c.Options.Name != "eu-de-1" || c.Options.Namespace != "team-a" || c.Options.KVEngineName != "team-a" || c.Options.KVVersion != 0 {
+		t.Errorf("expected settings of the repository, got %+v", c.Options)
+	}
+}
@@ -0,0 +1,179 @@
+// SPDX-FileCopyrightText: 2020 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package vault
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	vaultapi "github.com/hashicorp/vault/api"
+)
+
+const (
+	// tokenExpiryMargin is the time before the expiry of the token it is not used anymore, so requests in flight do not fail.
+	tokenExpiryMargin = 30 * time.Second
+	// tokenRecheckInterval is used instead of the TTL for tokens that do not expire, so rotated token files are picked up.
+	tokenRecheckInterval = time.Hour
+	// tokenRetryInterval is the time to wait after renewing the token and logging in failed.
+	tokenRetryInterval = 30 * time.Second
+)
+
+// authState is shared by all clients using the same connection.
+type authState struct {
+	mtx sync.Mutex
+	// validUntil is when the token is not used anymore. Zero before the first login.
+	validUntil time.Time
+	// renewAt is when the token is renewed, or replaced if it cannot be renewed, by WatchToken.
+	renewAt   time.Time
+	renewable bool
+	// target is the name of the Vault.
+	target   string
+	options  AuthOptions
+	roleID   string
+	secretID string
+}
+
+// relogin obtains a new token. Must be called while holding the lock.
+func (a *authState) relogin(client *vaultapi.Client, now time.Time) error {
+	ttl, renewable, err := a.login(client)
+	if err != nil {
+		return err
+	}
+	a.setTTL(ttl, renewable, now)
+	return nil
+}
+
+// setTTL records the TTL of the current token. Must be called while holding the lock.
+func (a *authState) setTTL(ttl time.Duration, renewable bool, now time.Time) {
+	tokenTTLSeconds.WithLabelValues(a.target).Set(ttl.Seconds())
+	if ttl == 0 {
+		ttl = tokenRecheckInterval
+	}
+	a.renewable = renewable
+	a.validUntil = now.Add(ttl - min(tokenExpiryMargin, ttl/3))
+	a.renewAt = now.Add(ttl * 2 / 3)
+}
+
+func (c *Client) authenticateIfNecessary() error {
+	c.auth.mtx.Lock()
+	defer c.auth.mtx.Unlock()
+
+	// use existing token if possible
+	now := time.Now()
+	if now.Before(c.auth.validUntil) {
+		return nil
+	}
+	return c.auth.relogin(c.client, now)
+}
+
+// reauthenticate logs in again after the given token was rejected, unless it was replaced in the meantime.
+func (c *Client) reauthenticate(rejectedToken string) error {
+	c.auth.mtx.Lock()
+	defer c.auth.mtx.Unlock()
+
+	if c.client.Token() != rejectedToken {
+		return nil
+	}
+	return c.auth.relogin(c.client, time.Now())
+}
+
+// do runs the call with a valid token. If Vault denies the call, e.g. because the token was revoked,
+// it logs in again and retries the call once.
+func (c *Client) do(call func() error) error {
+	if err := c.authenticateIfNecessary(); err != nil {
+		c.setUp(false)
+		return err
+	}
+	token := c.client.Token()
+	err := call()
+	if isPermissionDenied(err) {
+		c.Log.Info("permission denied by Vault, logging in again", "error", err.Error())
+		if err := c.reauthenticate(token); err != nil {
+			c.setUp(false)
+			return err
+		}
+		err = call()
+	}
+	c.setUp(!isUnavailable(err))
+	return err
+}
+
+func isPermissionDenied(err error) bool {
+	var respErr *vaultapi.ResponseError
+	return errors.As(err, &respErr) && respErr.StatusCode == http.StatusForbidden
+}
+
+// isUnavailable returns whether Vault could not be reached or failed to handle the request, e.g. because it is sealed.
+func isUnavailable(err error) bool {
+	var (
+		urlErr  *url.Error
+		respErr *vaultapi.ResponseError
+	)
+	return errors.As(err, &urlErr) || errors.As(err, &respErr) && respErr.StatusCode >= http.StatusInternalServerError
+}
+
+// setUp records whether Vault is available, see vaultUp.
+func (c *Client) setUp(isUp bool) {
+	value := 0.0
+	if isUp {
+		value = 1
+	}
+	vaultUp.WithLabelValues(c.Options.Name).Set(value)
+}
+
+// WatchToken renews the token before it expires and logs in again if it cannot be renewed, until the context is done.
+// Clients that did not log in yet, e.g. because Vault was unavailable, log in shortly after it is started.
+func (c *Client) WatchToken(ctx context.Context) error {
+	for {
+		c.auth.mtx.Lock()
+		wait := max(time.Until(c.auth.renewAt), time.Second)
+		c.auth.mtx.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(wait):
+		}
+
+		err := c.refreshToken()
+		c.setUp(err == nil)
+		if err != nil {
+			c.Log.Error(err, "failed to refresh Vault token, retrying", "retryIn", tokenRetryInterval.String())
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(tokenRetryInterval):
+			}
+		}
+	}
+}
+
+// refreshToken renews the token if possible. Otherwise, or if the TTL is too short, it logs in again.
+func (c *Client) refreshToken() error {
+	c.auth.mtx.Lock()
+	defer c.auth.mtx.Unlock()
+
+	now := time.Now()
+	if c.auth.renewable {
+		secret, err := c.client.Auth().Token().RenewSelf(0)
+		switch {
+		case err != nil:
+			c.Log.Info("failed to renew Vault token, logging in again", "error", err.Error())
+		case secret == nil || secret.Auth == nil:
+			c.Log.Info("failed to renew Vault token, logging in again", "error", "no token returned")
+		default:
+			// The TTL is limited by the maximum TTL of the token.
+			ttl := time.Duration(secret.Auth.LeaseDuration) * time.Second
+			if ttl > tokenExpiryMargin {
+				c.auth.setTTL(ttl, secret.Auth.Renewable, now)
+				return nil
+			}
+		}
+	}
+	return c.auth.relogin(c.client, now)
+}
@@ -0,0 +1,93 @@
+// SPDX-FileCopyrightText: 2020 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package vault
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestTokenLifecycle(t *testing.T) {
+	vault := newFakeVault(t, map[string]map[string]any{
+		"secrets/data/some/path": {"data": map[string]any{"password": "secret"}, "metadata": map[string]any{"version": 1}},
+	})
+	vault.update(func() {
+		vault.renewTTL = 900
+	})
+	logins := func() int {
+		return len(vault.requestsTo("auth/approle/login"))
+	}
+
+	c, err := NewClientIfSelected(Options{KVEngineName: "secrets", KVVersion: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ttl := testutil.ToFloat64(tokenTTLSeconds.WithLabelValues(DefaultTarget)); ttl != 600 {
+		t.Errorf("expected TTL 600, got %v", ttl)
+	}
+
+	// Calls denied after the token was revoked are retried once with a new token.
+	vault.update(func() {
+		vault.revoked["token-1"] = true
+	})
+	value, err := c.ReadValue("some/path", "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value != "secret" || logins() != 2 || c.client.Token() != "token-2" {
+		t.Errorf("unexpected value %q after %d logins", value, logins())
+	}
+
+	// Renewable tokens are renewed.
+	if err := c.refreshToken(); err != nil {
+		t.Fatal(err)
+	}
+	if logins() != 2 || testutil.ToFloat64(tokenTTLSeconds.WithLabelValues(DefaultTarget)) != 900 || time.Until(c.auth.renewAt) > 600*time.Second {
+		t.Errorf("expected token to be renewed, got %d logins", logins())
+	}
+
+	// Tokens reaching their maximum TTL are replaced.
+	vault.update(func() {
+		vault.renewTTL = 10
+	})
+	if err := c.refreshToken(); err != nil {
+		t.Fatal(err)
+	}
+	if logins() != 3 || c.client.Token() != "token-3" {
+		t.Errorf("expected new token, got %d logins", logins())
+	}
+}
+
+func TestUnavailableVault(t *testing.T) {
+	vault := newFakeVault(t, map[string]map[string]any{
+		"secrets/data/some/path": {"data": map[string]any{"password": "secret"}, "metadata": map[string]any{"version": 1}},
+	})
+	vault.update(func() {
+		vault.isDown = true
+	})
+
+	// Vault is not contacted when creating the client.
+	c, err := NewClient(Options{Name: "unavailable", Address: vault.url, KVEngineName: "secrets", KVVersion: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.ReadValue("some/path", "password"); err == nil {
+		t.Fatal("expected error while Vault is unavailable")
+	}
+	if up := testutil.ToFloat64(vaultUp.WithLabelValues("unavailable")); up != 0 {
+		t.Errorf("expected Vault to be down, got %v", up)
+	}
+
+	vault.update(func() {
+		vault.isDown = false
+	})
+	if value, err := c.ReadValue("some/path", "password"); err != nil || value != "secret" {
+		t.Fatalf("unexpected value %q: %v", value, err)
+	}
+	if up := testutil.ToFloat64(vaultUp.WithLabelValues("unavailable")); up != 1 {
+		t.Errorf("expected Vault to be up, got %v", up)
+	}
+}
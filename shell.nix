@@ -17,6 +17,7 @@ mkShell {
     renovate
     reuse
     setup-envtest
+    sops # interoperability tests of pkg/sops
     syft
     typos
     # keep this line if you use bash